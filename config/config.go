@@ -10,14 +10,64 @@ type Config struct {
 	DBUri string `mapstructure:"MONGODB_LOCAL_URI"`
 	Port  string `mapstructure:"PORT"`
 
-	AccessTokenPrivateKey  string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY"`
-	AccessTokenPublicKey   string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY"`
-	RefreshTokenPrivateKey string        `mapstructure:"REFRESH_TOKEN_PRIVATE_KEY"`
-	RefreshTokenPublicKey  string        `mapstructure:"REFRESH_TOKEN_PUBLIC_KEY"`
-	AccessTokenExpiresIn   time.Duration `mapstructure:"ACCESS_TOKEN_EXPIRED_IN"`
-	RefreshTokenExpiresIn  time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRED_IN"`
-	AccessTokenMaxAge      int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
-	RefreshTokenMaxAge     int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
+	AccessTokenPrivateKey   string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY"`
+	AccessTokenPublicKey    string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY"`
+	AccessTokenKeys         string        `mapstructure:"ACCESS_TOKEN_KEYS"`
+	AccessTokenSigningKeyId string        `mapstructure:"ACCESS_TOKEN_SIGNING_KEY_ID"`
+	RefreshTokenPrivateKey  string        `mapstructure:"REFRESH_TOKEN_PRIVATE_KEY"`
+	RefreshTokenPublicKey   string        `mapstructure:"REFRESH_TOKEN_PUBLIC_KEY"`
+	AccessTokenExpiresIn    time.Duration `mapstructure:"ACCESS_TOKEN_EXPIRED_IN"`
+	RefreshTokenExpiresIn   time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRED_IN"`
+	AccessTokenMaxAge       int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
+	RefreshTokenMaxAge      int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
+	TokenIssuer             string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience           string        `mapstructure:"TOKEN_AUDIENCE"`
+	TokenLeeway             time.Duration `mapstructure:"TOKEN_LEEWAY"`
+
+	TwoFactorIssuer        string        `mapstructure:"TWO_FACTOR_ISSUER"`
+	TwoFactorEncryptionKey string        `mapstructure:"TWO_FACTOR_ENCRYPTION_KEY"`
+	MFAChallengeExpiresIn  time.Duration `mapstructure:"MFA_CHALLENGE_EXPIRED_IN"`
+
+	WebAuthnRPID   string `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName string `mapstructure:"WEBAUTHN_RP_NAME"`
+	WebAuthnOrigin string `mapstructure:"WEBAUTHN_ORIGIN"`
+
+	RolePermissions string `mapstructure:"ROLE_PERMISSIONS"`
+
+	TokenHashSecret string `mapstructure:"TOKEN_HASH_SECRET"`
+
+	PasswordMinLength     int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int    `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordRequireUpper  bool   `mapstructure:"PASSWORD_REQUIRE_UPPERCASE"`
+	PasswordRequireLower  bool   `mapstructure:"PASSWORD_REQUIRE_LOWERCASE"`
+	PasswordRequireDigit  bool   `mapstructure:"PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol bool   `mapstructure:"PASSWORD_REQUIRE_SYMBOL"`
+	PasswordDenylist      string `mapstructure:"PASSWORD_DENYLIST"`
+	PasswordBreachedFile  string `mapstructure:"PASSWORD_BREACHED_FILE"`
+
+	PasswordHashAlgorithm string `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	Argon2Memory          uint32 `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations      uint32 `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     uint8  `mapstructure:"ARGON2_PARALLELISM"`
+	BcryptCost            int    `mapstructure:"BCRYPT_COST"`
+	PasswordPeppers       string `mapstructure:"PASSWORD_PEPPERS"`
+	PasswordPepperVersion string `mapstructure:"PASSWORD_PEPPER_VERSION"`
+
+	LoginMaxAttempts        int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginLockoutDuration    time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginLockoutMaxDuration time.Duration `mapstructure:"LOGIN_LOCKOUT_MAX_DURATION"`
+
+	RateLimitBackend  string `mapstructure:"RATE_LIMIT_BACKEND"`
+	RateLimits        string `mapstructure:"RATE_LIMITS"`
+	RateLimitFailOpen bool   `mapstructure:"RATE_LIMIT_FAIL_OPEN"`
+	TrustedProxies    string `mapstructure:"TRUSTED_PROXIES"`
+
+	AuditLogRetention time.Duration `mapstructure:"AUDIT_LOG_RETENTION"`
+
+	AccountDeletionGracePeriod time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	AccountDeletionInterval    time.Duration `mapstructure:"ACCOUNT_DELETION_INTERVAL"`
+
+	DataExportExpiresIn time.Duration `mapstructure:"DATA_EXPORT_EXPIRED_IN"`
 
 	EmailFrom string `mapstructure:"EMAIL_FROM"`
 	SMTPHost  string `mapstructure:"SMTP_HOST"`
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+)
+
+type AdminController struct {
+	adminService services.AdminService
+}
+
+func NewAdminController(adminService services.AdminService) AdminController {
+	return AdminController{adminService}
+}
+
+func (ac *AdminController) ListUsers(ctx *gin.Context) {
+	var query models.UserListQuery
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.adminService.ListUsers(&query)
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) GetUser(ctx *gin.Context) {
+	response := ac.adminService.GetUser(ctx.Param("id"))
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) UpdateUserRole(ctx *gin.Context) {
+	var input *models.UpdateRoleInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.adminService.UpdateUserRole(currentUser, ctx.Param("id"), input.Role)
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) VerifyUser(ctx *gin.Context) {
+	response := ac.adminService.VerifyUser(ctx.Param("id"))
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) DisableUser(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := ac.adminService.SetUserDisabled(currentUser, ctx.Param("id"), true)
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) EnableUser(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := ac.adminService.SetUserDisabled(currentUser, ctx.Param("id"), false)
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) UnlockUser(ctx *gin.Context) {
+	response := ac.adminService.UnlockUser(ctx.Param("id"))
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) DeleteUser(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := ac.adminService.DeleteUser(currentUser, ctx.Param("id"))
+
+	respondAdmin(ctx, response)
+}
+
+func (ac *AdminController) ListAuditEvents(ctx *gin.Context) {
+	var query models.AuditEventQuery
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.adminService.ListAuditEvents(&query)
+
+	respondAdmin(ctx, response)
+}
+
+func respondAdmin(ctx *gin.Context, response *models.AuthServiceResponse) {
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	body := gin.H{"status": response.Status}
+
+	if response.Message != "" {
+		body["message"] = response.Message
+	}
+
+	if response.Data != nil {
+		body["data"] = response.Data
+	}
+
+	ctx.JSON(response.StatusCode, body)
+}
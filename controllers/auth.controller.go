@@ -9,7 +9,6 @@ import (
 	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/models"
 	"github.com/tonybobo/auth-template/services"
-	"github.com/tonybobo/auth-template/utils"
 )
 
 type AuthController struct {
@@ -36,7 +35,7 @@ func (ac *AuthController) SignUpUser(ctx *gin.Context) {
 		return
 	}
 
-	response := ac.authService.SignUpUser(user)
+	response := ac.authService.SignUpUser(user, clientInfo(ctx))
 
 	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 
@@ -49,20 +48,107 @@ func (ac *AuthController) SignInUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
 		return
 	}
-	config, _ := config.LoadConfig(".")
 
-	response := ac.authService.SignInUser(credential)
+	response := ac.authService.SignInUser(credential, clientInfo(ctx))
+
+	respondSignIn(ctx, response)
+}
+
+func (ac *AuthController) RequestMagicLink(ctx *gin.Context) {
+	var input models.PasswordlessInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.authService.RequestMagicLink(input.Email)
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (ac *AuthController) SignInWithMagicLink(ctx *gin.Context) {
+	token := ctx.Params.ByName("token")
+
+	response := ac.authService.SignInWithMagicLink(token, clientInfo(ctx))
+
+	respondSignIn(ctx, response)
+}
+
+func (ac *AuthController) RequestEmailOTP(ctx *gin.Context) {
+	var input models.PasswordlessInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.authService.RequestEmailOTP(input.Email)
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (ac *AuthController) SignInWithEmailOTP(ctx *gin.Context) {
+	var input *models.EmailOTPInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.authService.SignInWithEmailOTP(input, clientInfo(ctx))
 
+	respondSignIn(ctx, response)
+}
+
+// respondSignIn writes the response of a first factor login, which is either
+// an MFA challenge or the tokens of the new session.
+func respondSignIn(ctx *gin.Context, response *models.AuthServiceResponse) {
 	if response.Err != nil {
 		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 		return
 	}
 
+	if response.MFAToken != "" {
+		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": response.Message, "mfa_token": response.MFAToken})
+		return
+	}
+
+	setAuthCookies(ctx, response)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": response.AccessToken, "refresh_token": response.RefreshAccessToken})
+}
+
+func (ac *AuthController) VerifyMFA(ctx *gin.Context) {
+	var challenge *models.MFAChallengeInput
+
+	if err := ctx.ShouldBindJSON(&challenge); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.authService.VerifyMFA(challenge, clientInfo(ctx))
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	setAuthCookies(ctx, response)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": response.AccessToken, "refresh_token": response.RefreshAccessToken})
+}
+
+// setAuthCookies sets the cookies of a successful login.
+func setAuthCookies(ctx *gin.Context, response *models.AuthServiceResponse) {
+	config, _ := config.LoadConfig(".")
+
 	ctx.SetCookie("access_token", response.AccessToken, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
 	ctx.SetCookie("refresh_token", response.RefreshAccessToken, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
 	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+}
 
-	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": response.AccessToken, "refresh_token": response.RefreshAccessToken})
+// clientInfo describes the client of the request for the audit log and the
+// session list.
+func clientInfo(ctx *gin.Context) models.ClientInfo {
+	return models.ClientInfo{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
 }
 
 func (ac *AuthController) RefreshAccessToken(ctx *gin.Context) {
@@ -77,31 +163,111 @@ func (ac *AuthController) RefreshAccessToken(ctx *gin.Context) {
 
 	config, _ := config.LoadConfig(".")
 
-	response := ac.userService.RefreshAccessToken(cookie)
+	response := ac.userService.RefreshAccessToken(cookie, clientInfo(ctx))
 
 	if response.Err != nil {
 		ctx.AbortWithStatusJSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 		return
 	}
 
+	body := gin.H{"status": response.Status, "access_token": response.AccessToken}
+
 	ctx.SetCookie("access_token", response.AccessToken, config.AccessTokenMaxAge*60, "/", "localhost", false, true)
+	if response.RefreshAccessToken != "" {
+		ctx.SetCookie("refresh_token", response.RefreshAccessToken, config.RefreshTokenMaxAge*60, "/", "localhost", false, true)
+		body["refresh_token"] = response.RefreshAccessToken
+	}
 	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", "localhost", false, true)
 
-	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "access_token": response.AccessToken})
+	ctx.JSON(response.StatusCode, body)
+}
+
+// LogoutRefreshToken ends the session of the refresh_token cookie, which
+// still works once the access token has expired. Without a usable cookie the
+// request moves on to LogoutUser and its access token.
+func (ac *AuthController) LogoutRefreshToken(ctx *gin.Context) {
+	cookie, err := ctx.Cookie("refresh_token")
+
+	if err != nil || cookie == "" {
+		ctx.Next()
+		return
+	}
+
+	response := ac.userService.LogoutRefreshToken(cookie)
+
+	if response.StatusCode == http.StatusForbidden {
+		ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+		ctx.Next()
+		return
+	}
+
+	ctx.Abort()
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	clearAuthCookies(ctx)
+	ctx.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
 func (ac *AuthController) LogoutUser(ctx *gin.Context) {
+	currentSession := ctx.MustGet("currentSession").(*models.Session)
+
+	response := ac.userService.Logout(currentSession.ID.Hex())
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	clearAuthCookies(ctx)
+	ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func clearAuthCookies(ctx *gin.Context) {
 	ctx.SetCookie("access_token", "", -1, "/", "localhost", false, true)
 	ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
 	ctx.SetCookie("logged_in", "", -1, "/", "localhost", false, true)
+}
+
+func (ac *AuthController) LogoutEverywhere(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := ac.userService.LogoutEverywhere(currentUser.ID.Hex())
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	clearAuthCookies(ctx)
 	ctx.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
 func (ac *AuthController) VerifyEmail(ctx *gin.Context) {
-	code := ctx.Params.ByName("verificationCode")
-	verificationCode := utils.Encode(code)
+	verificationCode := ctx.Params.ByName("verificationCode")
 
-	response := ac.userService.VerifyEmail(verificationCode)
+	response := ac.userService.VerifyEmail(verificationCode, clientInfo(ctx))
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (ac *AuthController) ConfirmEmailChange(ctx *gin.Context) {
+	response := ac.userService.ConfirmEmailChange(ctx.Param("token"), clientInfo(ctx))
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (ac *AuthController) ResendVerification(ctx *gin.Context) {
+	var input models.ResendVerificationInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ac.authService.ResendVerification(input.Email, clientInfo(ctx))
 
 	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 }
@@ -113,7 +279,7 @@ func (ac *AuthController) ForgetPassword(ctx *gin.Context) {
 		return
 	}
 
-	response := ac.userService.ForgetPassword(credential.Email)
+	response := ac.userService.ForgetPassword(credential.Email, clientInfo(ctx))
 
 	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 }
@@ -127,16 +293,14 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	response := ac.userService.ResetPassword(userCredential, resetToken)
+	response := ac.userService.ResetPassword(userCredential, resetToken, clientInfo(ctx))
 
 	if response.Err != nil {
 		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Err.Error()})
 		return
 	}
 
-	ctx.SetCookie("access_token", "", -1, "/", "localhost", false, true)
-	ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
-	ctx.SetCookie("logged_in", "", -1, "/", "localhost", false, true)
+	clearAuthCookies(ctx)
 
 	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
 }
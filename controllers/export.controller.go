@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+)
+
+type ExportController struct {
+	exportService services.ExportService
+}
+
+func NewExportController(exportService services.ExportService) ExportController {
+	return ExportController{exportService}
+}
+
+func (ec *ExportController) RequestExport(ctx *gin.Context) {
+	var input models.DataExportInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := ec.exportService.RequestExport(currentUser, input.Format, clientInfo(ctx))
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (ec *ExportController) DownloadExport(ctx *gin.Context) {
+	response := ec.exportService.DownloadExport(ctx.Param("token"))
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	export := response.Data.(*models.DataExport)
+
+	contentType := "application/json"
+	if export.Format == models.DataExportFormatZIP {
+		contentType = "application/zip"
+	}
+
+	ctx.Header("Content-Disposition", "attachment; filename=data-export."+export.Format)
+	ctx.Data(http.StatusOK, contentType, export.Data)
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/services"
+)
+
+// jwksMaxAge is how long clients may cache the keys. A new key has to be
+// published at least this long before it starts signing tokens.
+const jwksMaxAge = "max-age=300"
+
+type KeyController struct {
+	keyService services.KeyService
+}
+
+func NewKeyController(keyService services.KeyService) KeyController {
+	return KeyController{keyService}
+}
+
+func (kc *KeyController) JWKS(ctx *gin.Context) {
+	response := kc.keyService.JWKS()
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.Header("Cache-Control", "public, "+jwksMaxAge)
+	ctx.JSON(response.StatusCode, response.Data)
+}
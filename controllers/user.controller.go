@@ -20,3 +20,144 @@ func (uc *UserController) GetMe(ctx *gin.Context) {
 	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
 	ctx.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"user": models.FilteredResponse(currentUser)}})
 }
+
+func (uc *UserController) UpdateProfile(ctx *gin.Context) {
+	var input *models.UpdateProfileInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.UpdateProfile(currentUser, input)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message, "data": gin.H{"user": models.FilteredResponse(response.User)}})
+}
+
+func (uc *UserController) DeleteAccount(ctx *gin.Context) {
+	var input *models.DeleteAccountInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.DeleteAccount(currentUser, input, clientInfo(ctx))
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	clearAuthCookies(ctx)
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (uc *UserController) ListSessions(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	currentSession := ctx.MustGet("currentSession").(*models.Session)
+
+	response := uc.userService.ListSessions(currentUser, currentSession.ID)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "data": response.Data})
+}
+
+func (uc *UserController) RevokeSession(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := uc.userService.RevokeSession(currentUser, ctx.Param("id"))
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (uc *UserController) ChangePassword(ctx *gin.Context) {
+	var input *models.ChangePasswordInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+	currentSession := ctx.MustGet("currentSession").(*models.Session)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.ChangePassword(currentUser, currentSession.ID, input, clientInfo(ctx))
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (uc *UserController) EnrollTwoFactor(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := uc.userService.EnrollTwoFactor(currentUser)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message, "data": response.Data})
+}
+
+func (uc *UserController) ConfirmTwoFactor(ctx *gin.Context) {
+	var input *models.TwoFactorCodeInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.ConfirmTwoFactor(currentUser, input.Code)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message, "data": response.Data})
+}
+
+func (uc *UserController) DisableTwoFactor(ctx *gin.Context) {
+	var input *models.TwoFactorCodeInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.DisableTwoFactor(currentUser, input.Code)
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+}
+
+func (uc *UserController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var input *models.TwoFactorCodeInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := uc.userService.RegenerateRecoveryCodes(currentUser, input.Code)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message, "data": response.Data})
+}
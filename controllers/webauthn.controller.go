@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+)
+
+type WebAuthnController struct {
+	webAuthnService services.WebAuthnService
+}
+
+func NewWebAuthnController(webAuthnService services.WebAuthnService) WebAuthnController {
+	return WebAuthnController{webAuthnService}
+}
+
+func (wc *WebAuthnController) BeginRegistration(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	response := wc.webAuthnService.BeginRegistration(currentUser)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "data": response.Data})
+}
+
+func (wc *WebAuthnController) FinishRegistration(ctx *gin.Context) {
+	var credential *models.WebAuthnRegistrationInput
+	currentUser := ctx.MustGet("currentUser").(*models.DBResponse)
+
+	if err := ctx.ShouldBindJSON(&credential); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := wc.webAuthnService.FinishRegistration(currentUser, credential)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message, "data": response.Data})
+}
+
+func (wc *WebAuthnController) BeginLogin(ctx *gin.Context) {
+	var input *models.WebAuthnLoginOptionsInput
+
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+			return
+		}
+	}
+
+	response := wc.webAuthnService.BeginLogin(input)
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "data": response.Data})
+}
+
+func (wc *WebAuthnController) FinishLogin(ctx *gin.Context) {
+	var assertion *models.WebAuthnAssertionInput
+
+	if err := ctx.ShouldBindJSON(&assertion); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail", "message": err.Error()})
+		return
+	}
+
+	response := wc.webAuthnService.FinishLogin(assertion, clientInfo(ctx))
+
+	if response.Err != nil {
+		ctx.JSON(response.StatusCode, gin.H{"status": response.Status, "message": response.Message})
+		return
+	}
+
+	setAuthCookies(ctx, response)
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "success", "access_token": response.AccessToken, "refresh_token": response.RefreshAccessToken})
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,7 @@ import (
 	"github.com/tonybobo/auth-template/repository"
 	"github.com/tonybobo/auth-template/routes"
 	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -32,6 +34,24 @@ var (
 	AuthController      controllers.AuthController
 	AuthRouteController routes.AuthRouteController
 
+	webAuthnService         services.WebAuthnService
+	WebAuthnController      controllers.WebAuthnController
+	WebAuthnRouteController routes.WebAuthnRouteController
+
+	exportService         services.ExportService
+	ExportController      controllers.ExportController
+	ExportRouteController routes.ExportRouteController
+
+	keyService         services.KeyService
+	KeyController      controllers.KeyController
+	KeyRouteController routes.KeyRouteController
+
+	accountDeletionWorker *services.AccountDeletionWorker
+
+	adminService         services.AdminService
+	AdminController      controllers.AdminController
+	AdminRouteController routes.AdminRouteController
+
 	temp *template.Template
 )
 
@@ -42,6 +62,20 @@ func init() {
 		log.Fatal("Could not load environment variables", err)
 	}
 
+	if config.TokenHashSecret == "" {
+		log.Fatal(utils.ErrTokenHashSecretMissing)
+	}
+
+	if _, _, err := utils.LoadPasswordPeppers(); err != nil {
+		log.Fatal("Could not load PASSWORD_PEPPERS ", err)
+	}
+
+	utils.LoadPasswordPolicy()
+
+	if _, err := utils.LoadAccessTokenKeyRing(); err != nil {
+		log.Fatal("Could not load the access token keys ", err)
+	}
+
 	ctx = context.TODO()
 
 	mongoConn := options.Client().ApplyURI(config.DBUri)
@@ -58,17 +92,64 @@ func init() {
 	fmt.Print("Successfully connected to DB")
 	collection := mongoClient.Database("golang_mongodb").Collection("users")
 	authRepository := repository.NewAuthRepository(collection)
-	userService = services.NewUserServiceImpl(authRepository, ctx, temp)
-	authService = services.NewAuthService(authRepository, ctx, temp)
+	refreshTokenCollection := mongoClient.Database("golang_mongodb").Collection("refresh_tokens")
+	refreshTokenRepository := repository.NewRefreshTokenRepository(refreshTokenCollection)
+	sessionCollection := mongoClient.Database("golang_mongodb").Collection("sessions")
+	sessionRepository := repository.NewSessionRepository(sessionCollection)
+	webAuthnCredentialCollection := mongoClient.Database("golang_mongodb").Collection("webauthn_credentials")
+	webAuthnChallengeCollection := mongoClient.Database("golang_mongodb").Collection("webauthn_challenges")
+	webAuthnRepository := repository.NewWebAuthnRepository(webAuthnCredentialCollection, webAuthnChallengeCollection)
+	auditCollection := mongoClient.Database("golang_mongodb").Collection("audit_events")
+	auditRepository := repository.NewAuditRepository(auditCollection, config.AuditLogRetention)
+	userService = services.NewUserServiceImpl(authRepository, refreshTokenRepository, sessionRepository, auditRepository, ctx, temp)
+	authService = services.NewAuthService(authRepository, refreshTokenRepository, sessionRepository, auditRepository, ctx, temp)
+
+	rateLimiter := utils.NewMemoryRateLimiter()
+	if config.RateLimitBackend == "mongo" {
+		rateLimitCollection := mongoClient.Database("golang_mongodb").Collection("rate_limits")
+		rateLimiter = repository.NewRateLimitRepository(rateLimitCollection)
+	}
 
 	AuthController = controllers.NewAuthController(authService, userService, ctx)
-	AuthRouteController = routes.NewAuthRouteController(AuthController)
+	AuthRouteController = routes.NewAuthRouteController(AuthController, rateLimiter)
+
+	webAuthnService = services.NewWebAuthnService(authRepository, webAuthnRepository, refreshTokenRepository, sessionRepository, auditRepository, ctx)
+	WebAuthnController = controllers.NewWebAuthnController(webAuthnService)
+	WebAuthnRouteController = routes.NewWebAuthnRouteController(WebAuthnController)
+
+	dataExportCollection := mongoClient.Database("golang_mongodb").Collection("data_exports")
+	dataExportRepository := repository.NewDataExportRepository(dataExportCollection)
+	exportService = services.NewExportService(sessionRepository, webAuthnRepository, auditRepository, dataExportRepository, ctx, temp)
+	ExportController = controllers.NewExportController(exportService)
+	ExportRouteController = routes.NewExportRouteController(ExportController, rateLimiter)
+
+	keyService = services.NewKeyService()
+	KeyController = controllers.NewKeyController(keyService)
+	KeyRouteController = routes.NewKeyRouteController(KeyController)
+
+	accountDeletionWorker = services.NewAccountDeletionWorker(authRepository, refreshTokenRepository, sessionRepository, webAuthnRepository, auditRepository, dataExportRepository, ctx)
+
+	adminService = services.NewAdminService(authRepository, refreshTokenRepository, sessionRepository, auditRepository, accountDeletionWorker, ctx)
+	AdminController = controllers.NewAdminController(adminService)
+	AdminRouteController = routes.NewAdminRouteController(AdminController)
 
 	UserController = controllers.NewUserController(userService)
 	UserRouteController = routes.NewUserRouteController(UserController)
 
 	server = gin.Default()
 
+	// Without trusted proxies the client IP is the address of the connection,
+	// so a client cannot pick its own rate limit bucket with X-Forwarded-For.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(config.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := server.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Could not load TRUSTED_PROXIES ", err)
+	}
+
 }
 
 func SetUpRouter() *gin.Engine {
@@ -79,6 +160,8 @@ func SetUpRouter() *gin.Engine {
 
 	server.Use(cors.New(corsConfig))
 
+	KeyRouteController.KeyRoute(&server.RouterGroup)
+
 	router := server.Group("/api")
 
 	router.GET("/healthchecker", func(ctx *gin.Context) {
@@ -87,6 +170,9 @@ func SetUpRouter() *gin.Engine {
 
 	AuthRouteController.AuthRoute(router, userService)
 	UserRouteController.UserRoute(router, userService)
+	ExportRouteController.ExportRoute(router, userService)
+	WebAuthnRouteController.WebAuthnRoute(router, userService)
+	AdminRouteController.AdminRoute(router, userService)
 	return server
 }
 
@@ -96,6 +182,7 @@ func main() {
 		log.Fatal("Could not load environment variables", err)
 	}
 	defer mongoClient.Disconnect(ctx)
+	go accountDeletionWorker.Run(config.AccountDeletionInterval)
 	server := SetUpRouter()
 
 	log.Fatal(server.Run(":" + config.Port))
@@ -1,12 +1,10 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/services"
 	"github.com/tonybobo/auth-template/utils"
 )
@@ -30,23 +28,40 @@ func DeserializeUser(userService services.UserService) gin.HandlerFunc {
 			return
 		}
 
-		config, _ := config.LoadConfig(".")
+		ring, err := utils.LoadAccessTokenKeyRing()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"status": "fail", "message": err.Error()})
+			return
+		}
 
-		sub, err := utils.ValidateToken(access_token, config.AccessTokenPublicKey)
+		claims, err := utils.ValidateToken(access_token, ring)
 
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": err.Error()})
 			return
 		}
 
-		user, err := userService.FindUserById(fmt.Sprint(sub))
+		user, err := userService.FindUserById(claims.Subject)
 
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The user belonging to this token does not exist"})
 			return
 		}
 
+		if user.Disabled {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "Your account has been disabled"})
+			return
+		}
+
+		session, err := userService.FindSessionById(claims.SessionID)
+
+		if err != nil || session.Revoked || session.UserID != user.ID {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "Your session has expired, please login again"})
+			return
+		}
+
 		ctx.Set("currentUser", user)
+		ctx.Set("currentSession", session)
 		ctx.Next()
 
 	}
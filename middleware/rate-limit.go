@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/models"
+)
+
+// maxRateLimitBody caps how much of a request body is read to find the email.
+const maxRateLimitBody = 1 << 16
+
+// RateLimit takes a token per request from the bucket of the client IP, from
+// the bucket of the signed in user when DeserializeUser ran before it and,
+// when the JSON body has one, from the bucket of the target email. The client
+// IP only comes from X-Forwarded-For when the engine trusts the proxy that
+// sent it. When the backend fails, requests are let through if failOpen is
+// set, so an outage does not lock every user out, and refused otherwise.
+func RateLimit(limiter models.RateLimiter, route string, policy models.RateLimitPolicy, failOpen bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		keys := []string{route + ":ip:" + ctx.ClientIP()}
+		if user, ok := ctx.Value("currentUser").(*models.DBResponse); ok && user != nil {
+			keys = append(keys, route+":user:"+user.ID.Hex())
+		}
+		if email := requestEmail(ctx); email != "" {
+			keys = append(keys, route+":email:"+email)
+		}
+
+		var retryAfter time.Duration
+		for _, key := range keys {
+			allowed, wait, err := limiter.Allow(ctx, key, policy)
+			if err != nil {
+				log.Println("rate limit error", route, err)
+				if failOpen {
+					continue
+				}
+				ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"status": "fail", "message": "Please try again later"})
+				return
+			}
+			if !allowed && wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+
+		if retryAfter > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"status": "fail", "message": "Too many requests, please try again later"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requestEmail reads the email from a JSON body and puts the body back for the
+// handler.
+func requestEmail(ctx *gin.Context) string {
+	if ctx.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxRateLimitBody))
+	if err != nil {
+		return ""
+	}
+	ctx.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), ctx.Request.Body))
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(input.Email))
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+const forbiddenMessage = "You do not have permission to perform this action"
+
+// RequireRole only lets through users that have one of the roles. It must run
+// after DeserializeUser.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := currentUser(ctx)
+		if !ok {
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": forbiddenMessage})
+	}
+}
+
+// RequirePermission only lets through users whose role grants all of the
+// permissions. The mapping is read from ROLE_PERMISSIONS and falls back to
+// models.DefaultRolePermissions. It must run after DeserializeUser.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	rolePermissions := utils.LoadRolePermissions()
+
+	return func(ctx *gin.Context) {
+		user, ok := currentUser(ctx)
+		if !ok {
+			return
+		}
+
+		for _, permission := range permissions {
+			if !rolePermissions.Allows(user.Role, permission) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": forbiddenMessage})
+				return
+			}
+		}
+
+		ctx.Next()
+	}
+}
+
+func currentUser(ctx *gin.Context) (*models.DBResponse, bool) {
+	value, exists := ctx.Get("currentUser")
+	user, ok := value.(*models.DBResponse)
+
+	if !exists || !ok || user == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "You are not logged in"})
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,98 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+)
+
+type MockAdminService struct {
+	mock.Mock
+}
+
+func (m *MockAdminService) ListUsers(query *models.UserListQuery) *models.AuthServiceResponse {
+	ret := m.Called(query)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) GetUser(id string) *models.AuthServiceResponse {
+	ret := m.Called(id)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) UpdateUserRole(admin *models.DBResponse, id string, role string) *models.AuthServiceResponse {
+	ret := m.Called(admin, id, role)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) VerifyUser(id string) *models.AuthServiceResponse {
+	ret := m.Called(id)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) SetUserDisabled(admin *models.DBResponse, id string, disabled bool) *models.AuthServiceResponse {
+	ret := m.Called(admin, id, disabled)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) DeleteUser(admin *models.DBResponse, id string) *models.AuthServiceResponse {
+	ret := m.Called(admin, id)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) UnlockUser(id string) *models.AuthServiceResponse {
+	ret := m.Called(id)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAdminService) ListAuditEvents(query *models.AuditEventQuery) *models.AuthServiceResponse {
+	ret := m.Called(query)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
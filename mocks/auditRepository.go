@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	ret := m.Called(ctx, event)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuditRepository) ListAuditEvents(ctx context.Context, query *models.AuditEventQuery) ([]*models.AuditEvent, int64, error) {
+	ret := m.Called(ctx, query)
+
+	var r0 []*models.AuditEvent
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.AuditEvent)
+	}
+
+	var r1 int64
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(int64)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, r1, r2
+}
+
+func (m *MockAuditRepository) AnonymizeAuditEvents(ctx context.Context, actorId primitive.ObjectID, email string) error {
+	ret := m.Called(ctx, actorId, email)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuditRepository) FindUserAuditEvents(ctx context.Context, actorId primitive.ObjectID) ([]*models.AuditEvent, error) {
+	ret := m.Called(ctx, actorId)
+
+	var r0 []*models.AuditEvent
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.AuditEvent)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/tonybobo/auth-template/models"
@@ -34,16 +35,38 @@ func (m *MockAuthRepository) SignUpUser(ctx context.Context, user *models.SignUp
 	return r0, r1, r2
 }
 
-func (m *MockAuthRepository) ClearResetPasswordToken(ctx context.Context, token, password string) error {
+func (m *MockAuthRepository) FindUserByResetToken(ctx context.Context, token string) (*models.DBResponse, error) {
+	ret := m.Called(ctx, token)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) ClearResetPasswordToken(ctx context.Context, token, password string) (*models.DBResponse, error) {
 	ret := m.Called(ctx, token, password)
 
-	var r0 error
+	var r0 *models.DBResponse
 
 	if ret.Get(0) != nil {
-		r0 = ret.Get(0).(error)
+		r0 = ret.Get(0).(*models.DBResponse)
 	}
 
-	return r0
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
 }
 
 func (m *MockAuthRepository) FindUserByEmail(ctx context.Context, email string) (*models.DBResponse, error) {
@@ -97,13 +120,13 @@ func (m *MockAuthRepository) ResetPasswordToken(ctx context.Context, email, pass
 	return r0, r1
 }
 
-func (m *MockAuthRepository) UpdateOne(ctx context.Context, field string, value interface{}) (*mongo.UpdateResult, error) {
-	ret := m.Called(ctx, field, value)
+func (m *MockAuthRepository) UpdateOne(ctx context.Context, id primitive.ObjectID, field string, value interface{}) (*models.DBResponse, error) {
+	ret := m.Called(ctx, id, field, value)
 
-	var r0 *mongo.UpdateResult
+	var r0 *models.DBResponse
 
 	if ret.Get(0) != nil {
-		r0 = ret.Get(0).(*mongo.UpdateResult)
+		r0 = ret.Get(0).(*models.DBResponse)
 	}
 
 	var r1 error
@@ -114,9 +137,50 @@ func (m *MockAuthRepository) UpdateOne(ctx context.Context, field string, value
 	return r0, r1
 }
 
-func (m *MockAuthRepository) VerifyEmail(ctx context.Context, verificationCode string) error {
+func (m *MockAuthRepository) VerifyEmail(ctx context.Context, verificationCode string) (*models.DBResponse, error) {
 	ret := m.Called(ctx, verificationCode)
 
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) ForgetPassword(ctx context.Context, email string) (*models.DBResponse, string, error) {
+	ret := m.Called(ctx, email)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 string
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, r1, r2
+}
+
+func (m *MockAuthRepository) SetTwoFactorSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	ret := m.Called(ctx, id, secret)
+
 	var r0 error
 
 	if ret.Get(0) != nil {
@@ -126,7 +190,127 @@ func (m *MockAuthRepository) VerifyEmail(ctx context.Context, verificationCode s
 	return r0
 }
 
-func (m *MockAuthRepository) ForgetPassword(ctx context.Context, email string) (*models.DBResponse, string, error) {
+func (m *MockAuthRepository) EnableTwoFactor(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) DisableTwoFactor(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) CreateMFAChallenge(ctx context.Context, id primitive.ObjectID, expiresAt time.Time) (string, error) {
+	ret := m.Called(ctx, id, expiresAt)
+
+	var r0 string
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) FindUserByMFAChallenge(ctx context.Context, token string) (*models.DBResponse, error) {
+	ret := m.Called(ctx, token)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) IncrementMFAChallengeAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error {
+	ret := m.Called(ctx, id, maxAttempts)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) error {
+	ret := m.Called(ctx, id, counter)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ClearMFAChallenge(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, hashedCodes []string) error {
+	ret := m.Called(ctx, id, hashedCodes)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hashedCode string) error {
+	ret := m.Called(ctx, id, hashedCode)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) CreateMagicLinkToken(ctx context.Context, email string) (*models.DBResponse, string, error) {
 	ret := m.Called(ctx, email)
 
 	var r0 *models.DBResponse
@@ -149,3 +333,294 @@ func (m *MockAuthRepository) ForgetPassword(ctx context.Context, email string) (
 
 	return r0, r1, r2
 }
+
+func (m *MockAuthRepository) ConsumeMagicLinkToken(ctx context.Context, token string) (*models.DBResponse, error) {
+	ret := m.Called(ctx, token)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) SetEmailOTP(ctx context.Context, id primitive.ObjectID, hashedCode string, expiresAt time.Time) error {
+	ret := m.Called(ctx, id, hashedCode, expiresAt)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) IncrementEmailOTPAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error {
+	ret := m.Called(ctx, id, maxAttempts)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ClearEmailOTP(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.DBResponse, int64, error) {
+	ret := m.Called(ctx, query)
+
+	var r0 []*models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.DBResponse)
+	}
+
+	var r1 int64
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(int64)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, r1, r2
+}
+
+func (m *MockAuthRepository) UpdateUserRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	ret := m.Called(ctx, id, role)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ForceVerifyUser(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) SetUserDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	ret := m.Called(ctx, id, disabled)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 int
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) LockUser(ctx context.Context, id primitive.ObjectID, until time.Time) error {
+	ret := m.Called(ctx, id, until)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ResetFailedLogins(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error {
+	ret := m.Called(ctx, id, hashedPassword)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	ret := m.Called(ctx, id, oldHash, newHash)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) RequestEmailChange(ctx context.Context, id primitive.ObjectID, email string) (string, error) {
+	ret := m.Called(ctx, id, email)
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockAuthRepository) ConfirmEmailChange(ctx context.Context, token string) (*models.DBResponse, error) {
+	ret := m.Called(ctx, token)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) ScheduleUserDeletion(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	ret := m.Called(ctx, id, at)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) CancelUserDeletion(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time, limit int64) ([]*models.DBResponse, error) {
+	ret := m.Called(ctx, now, limit)
+
+	var r0 []*models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.DBResponse)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockAuthRepository) MarkUserPurging(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	ret := m.Called(ctx, id, now)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) DeleteScheduledUser(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	ret := m.Called(ctx, id, now)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockAuthRepository) ResendVerificationCode(ctx context.Context, email string) (*models.DBResponse, string, error) {
+	ret := m.Called(ctx, email)
+
+	var r0 *models.DBResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DBResponse)
+	}
+
+	var r2 error
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, ret.String(1), r2
+}
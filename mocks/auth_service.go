@@ -20,8 +20,8 @@ func (m *MockAuthService) Test() *models.AuthServiceResponse {
 	return r0
 }
 
-func (m *MockAuthService) SignUpUser(user *models.SignUpInput) *models.AuthServiceResponse {
-	ret := m.Called(user)
+func (m *MockAuthService) SignUpUser(user *models.SignUpInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, client)
 	var r0 *models.AuthServiceResponse
 
 	if ret.Get(0) != nil {
@@ -31,8 +31,74 @@ func (m *MockAuthService) SignUpUser(user *models.SignUpInput) *models.AuthServi
 	return r0
 }
 
-func (m *MockAuthService) SignInUser(user *models.SignInInput) *models.AuthServiceResponse {
-	ret := m.Called(user)
+func (m *MockAuthService) SignInUser(user *models.SignInInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) VerifyMFA(challenge *models.MFAChallengeInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(challenge, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) RequestMagicLink(email string) *models.AuthServiceResponse {
+	ret := m.Called(email)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) SignInWithMagicLink(token string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(token, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) RequestEmailOTP(email string) *models.AuthServiceResponse {
+	ret := m.Called(email)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) SignInWithEmailOTP(input *models.EmailOTPInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(input, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockAuthService) ResendVerification(email string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(email, client)
 	var r0 *models.AuthServiceResponse
 
 	if ret.Get(0) != nil {
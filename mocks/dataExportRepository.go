@@ -0,0 +1,53 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockDataExportRepository struct {
+	mock.Mock
+}
+
+func (m *MockDataExportRepository) CreateDataExport(ctx context.Context, export *models.DataExport) (string, error) {
+	ret := m.Called(ctx, export)
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockDataExportRepository) FindDataExportByToken(ctx context.Context, token string) (*models.DataExport, error) {
+	ret := m.Called(ctx, token)
+
+	var r0 *models.DataExport
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.DataExport)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockDataExportRepository) DeleteUserDataExports(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
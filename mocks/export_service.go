@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+)
+
+type MockExportService struct {
+	mock.Mock
+}
+
+func (m *MockExportService) RequestExport(user *models.DBResponse, format string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, format, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockExportService) BuildExport(user *models.DBResponse, format string) error {
+	ret := m.Called(user, format)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockExportService) DownloadExport(token string) *models.AuthServiceResponse {
+	ret := m.Called(token)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+)
+
+type MockKeyService struct {
+	mock.Mock
+}
+
+func (m *MockKeyService) JWKS() *models.AuthServiceResponse {
+	ret := m.Called()
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
@@ -0,0 +1,102 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	ret := m.Called(ctx, token)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockRefreshTokenRepository) FindRefreshTokenById(ctx context.Context, id primitive.ObjectID) (*models.RefreshToken, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *models.RefreshToken
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.RefreshToken)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockRefreshTokenRepository) MarkRefreshTokenUsed(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockRefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, family primitive.ObjectID) error {
+	ret := m.Called(ctx, family)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockRefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockRefreshTokenRepository) RevokeOtherRefreshTokens(ctx context.Context, userId, family primitive.ObjectID) error {
+	ret := m.Called(ctx, userId, family)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockRefreshTokenRepository) DeleteUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
@@ -0,0 +1,137 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	ret := m.Called(ctx, session)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) FindSessionById(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *models.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.Session)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, id primitive.ObjectID, expiresAt time.Time, client models.ClientInfo) error {
+	ret := m.Called(ctx, id, expiresAt, client)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) RevokeSession(ctx context.Context, id primitive.ObjectID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) RevokeUserSessions(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) FindUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*models.Session, error) {
+	ret := m.Called(ctx, userId)
+
+	var r0 []*models.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.Session)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockSessionRepository) RevokeOtherSessions(ctx context.Context, userId, sessionId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId, sessionId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) DeleteUserSessions(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSessionRepository) FindAllUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*models.Session, error) {
+	ret := m.Called(ctx, userId)
+
+	var r0 []*models.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.Session)
+	}
+
+	var r1 error
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
@@ -3,6 +3,7 @@ package mocks
 import (
 	"github.com/stretchr/testify/mock"
 	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MockUserService struct {
@@ -26,8 +27,8 @@ func (m *MockUserService) FindUserById(id string) (*models.DBResponse, error) {
 	return r0, r1
 }
 
-func (m *MockUserService) UpdateOne(field string, value interface{}) (*models.DBResponse, error) {
-	ret := m.Called(field, value)
+func (m *MockUserService) UpdateOne(id string, field string, value interface{}) (*models.DBResponse, error) {
+	ret := m.Called(id, field, value)
 	var r0 *models.DBResponse
 
 	if ret.Get(0) != nil {
@@ -43,8 +44,8 @@ func (m *MockUserService) UpdateOne(field string, value interface{}) (*models.DB
 	return r0, r1
 }
 
-func (m *MockUserService) ForgetPassword(email string) *models.AuthServiceResponse {
-	ret := m.Called(email)
+func (m *MockUserService) ForgetPassword(email string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(email, client)
 	var r0 *models.AuthServiceResponse
 
 	if ret.Get(0) != nil {
@@ -54,7 +55,68 @@ func (m *MockUserService) ForgetPassword(email string) *models.AuthServiceRespon
 	return r0
 }
 
-func (m *MockUserService) RefreshAccessToken(cookie string) *models.AuthServiceResponse {
+func (m *MockUserService) RefreshAccessToken(cookie string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(cookie, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ResetPassword(user *models.ResetPasswordInput, resetToken string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, resetToken, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) VerifyEmail(verificationCode string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(verificationCode, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) FindSessionById(id string) (*models.Session, error) {
+	ret := m.Called(id)
+	var r0 *models.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.Session)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockUserService) Logout(sessionId string) *models.AuthServiceResponse {
+	ret := m.Called(sessionId)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) LogoutRefreshToken(cookie string) *models.AuthServiceResponse {
 	ret := m.Called(cookie)
 	var r0 *models.AuthServiceResponse
 
@@ -65,8 +127,107 @@ func (m *MockUserService) RefreshAccessToken(cookie string) *models.AuthServiceR
 	return r0
 }
 
-func (m *MockUserService) ResetPassword(user *models.ResetPasswordInput, resetToken string) *models.AuthServiceResponse {
-	ret := m.Called(user, resetToken)
+func (m *MockUserService) LogoutEverywhere(userId string) *models.AuthServiceResponse {
+	ret := m.Called(userId)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) EnrollTwoFactor(user *models.DBResponse) *models.AuthServiceResponse {
+	ret := m.Called(user)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ConfirmTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse {
+	ret := m.Called(user, code)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) DisableTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse {
+	ret := m.Called(user, code)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) RegenerateRecoveryCodes(user *models.DBResponse, code string) *models.AuthServiceResponse {
+	ret := m.Called(user, code)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ListSessions(user *models.DBResponse, currentSessionId primitive.ObjectID) *models.AuthServiceResponse {
+	ret := m.Called(user, currentSessionId)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) RevokeSession(user *models.DBResponse, sessionId string) *models.AuthServiceResponse {
+	ret := m.Called(user, sessionId)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ChangePassword(user *models.DBResponse, currentSessionId primitive.ObjectID, input *models.ChangePasswordInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, currentSessionId, input, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) UpdateProfile(user *models.DBResponse, input *models.UpdateProfileInput) *models.AuthServiceResponse {
+	ret := m.Called(user, input)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ConfirmEmailChange(token string, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(token, client)
 	var r0 *models.AuthServiceResponse
 
 	if ret.Get(0) != nil {
@@ -76,8 +237,8 @@ func (m *MockUserService) ResetPassword(user *models.ResetPasswordInput, resetTo
 	return r0
 }
 
-func (m *MockUserService) VerifyEmail(verificationCode string) *models.AuthServiceResponse {
-	ret := m.Called(verificationCode)
+func (m *MockUserService) DeleteAccount(user *models.DBResponse, input *models.DeleteAccountInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(user, input, client)
 	var r0 *models.AuthServiceResponse
 
 	if ret.Get(0) != nil {
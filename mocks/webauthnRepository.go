@@ -0,0 +1,115 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockWebAuthnRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebAuthnRepository) CreateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	ret := m.Called(ctx, challenge)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnRepository) ConsumeWebAuthnChallenge(ctx context.Context, challenge string, challengeType string) (*models.WebAuthnChallenge, error) {
+	ret := m.Called(ctx, challenge, challengeType)
+
+	var r0 *models.WebAuthnChallenge
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.WebAuthnChallenge)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockWebAuthnRepository) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	ret := m.Called(ctx, credential)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnRepository) FindWebAuthnCredentialById(ctx context.Context, credentialId []byte) (*models.WebAuthnCredential, error) {
+	ret := m.Called(ctx, credentialId)
+
+	var r0 *models.WebAuthnCredential
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.WebAuthnCredential)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockWebAuthnRepository) FindUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) ([]*models.WebAuthnCredential, error) {
+	ret := m.Called(ctx, userId)
+
+	var r0 []*models.WebAuthnCredential
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*models.WebAuthnCredential)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockWebAuthnRepository) UpdateWebAuthnSignCount(ctx context.Context, id primitive.ObjectID, signCount uint32) error {
+	ret := m.Called(ctx, id, signCount)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnRepository) DeleteUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) error {
+	ret := m.Called(ctx, userId)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
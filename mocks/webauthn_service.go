@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/models"
+)
+
+type MockWebAuthnService struct {
+	mock.Mock
+}
+
+func (m *MockWebAuthnService) BeginRegistration(user *models.DBResponse) *models.AuthServiceResponse {
+	ret := m.Called(user)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnService) FinishRegistration(user *models.DBResponse, credential *models.WebAuthnRegistrationInput) *models.AuthServiceResponse {
+	ret := m.Called(user, credential)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnService) BeginLogin(input *models.WebAuthnLoginOptionsInput) *models.AuthServiceResponse {
+	ret := m.Called(input)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnService) FinishLogin(assertion *models.WebAuthnAssertionInput, client models.ClientInfo) *models.AuthServiceResponse {
+	ret := m.Called(assertion, client)
+	var r0 *models.AuthServiceResponse
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*models.AuthServiceResponse)
+	}
+
+	return r0
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditLogin             = "login"
+	AuditLoginMFAChallenge = "login_mfa_challenge"
+	AuditLoginMFA          = "login_mfa"
+	AuditLoginMagicLink    = "login_magic_link"
+	AuditLoginEmailOTP     = "login_email_otp"
+	AuditLoginPasskey      = "login_passkey"
+	AuditRegister          = "register"
+	AuditVerifyEmail       = "verify_email"
+	AuditResendVerify      = "resend_verification"
+	AuditForgotPassword    = "forgot_password"
+	AuditResetPassword     = "reset_password"
+	AuditChangePassword    = "change_password"
+	AuditChangeEmail       = "change_email"
+	AuditDeleteAccount     = "delete_account"
+	AuditDataExport        = "data_export"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// ClientInfo describes where a request came from.
+type ClientInfo struct {
+	IP        string `json:"ip" bson:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+}
+
+// AuditEvent is a security relevant action. ActorID is empty when the action
+// could not be tied to a user, Email then holds what the client sent.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Type      string             `json:"type" bson:"type"`
+	Outcome   string             `json:"outcome" bson:"outcome"`
+	ActorID   primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent" bson:"user_agent"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuditEventQuery filters the admin audit log.
+type AuditEventQuery struct {
+	UserID string `form:"user_id"`
+	Type   string `form:"type"`
+	Page   int64  `form:"page,default=1" binding:"min=1"`
+	Limit  int64  `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+type AuditEventListResponse struct {
+	Events []*AuditEvent `json:"events"`
+	Total  int64         `json:"total"`
+	Page   int64         `json:"page"`
+	Limit  int64         `json:"limit"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DataExportFormatJSON = "json"
+	DataExportFormatZIP  = "zip"
+)
+
+type DataExportInput struct {
+	Format string `form:"format,default=json" binding:"oneof=json zip"`
+}
+
+// DataExport is a generated archive waiting to be downloaded. Token is the
+// hash of the token in the emailed link.
+type DataExport struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Token     string             `json:"-" bson:"token"`
+	Format    string             `json:"format" bson:"format"`
+	Data      []byte             `json:"-" bson:"data"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// UserDataExport is everything stored about a user, without secrets.
+type UserDataExport struct {
+	ExportedAt  time.Time             `json:"exported_at"`
+	Profile     UserResponse          `json:"profile"`
+	Sessions    []*Session            `json:"sessions"`
+	AuditEvents []*AuditEvent         `json:"audit_events"`
+	Passkeys    []*WebAuthnCredential `json:"passkeys"`
+}
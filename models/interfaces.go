@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -10,10 +11,110 @@ import (
 type AuthRepository interface {
 	FindUserById(ctx context.Context, id primitive.ObjectID) (*DBResponse, error)
 	FindUserByEmail(ctx context.Context, email string) (*DBResponse, error)
-	UpdateOne(ctx context.Context, field string, value interface{}) (*mongo.UpdateResult, error)
+	UpdateOne(ctx context.Context, id primitive.ObjectID, field string, value interface{}) (*DBResponse, error)
+	RequestEmailChange(ctx context.Context, id primitive.ObjectID, email string) (string, error)
+	ConfirmEmailChange(ctx context.Context, token string) (*DBResponse, error)
 	ResetPasswordToken(ctx context.Context, email, passwordResetToken string) (*mongo.UpdateResult, error)
-	VerifyEmail(ctx context.Context, verificationCode string) error
+	VerifyEmail(ctx context.Context, verificationCode string) (*DBResponse, error)
+	ResendVerificationCode(ctx context.Context, email string) (*DBResponse, string, error)
 	ForgetPassword(ctx context.Context, email string) (*DBResponse, string, error)
-	ClearResetPasswordToken(ctx context.Context, token, password string) error
+	FindUserByResetToken(ctx context.Context, token string) (*DBResponse, error)
+	ClearResetPasswordToken(ctx context.Context, token, hashedPassword string) (*DBResponse, error)
 	SignUpUser(ctx context.Context, user *SignUpInput) (*DBResponse, string, error)
+	SetTwoFactorSecret(ctx context.Context, id primitive.ObjectID, secret string) error
+	EnableTwoFactor(ctx context.Context, id primitive.ObjectID) error
+	DisableTwoFactor(ctx context.Context, id primitive.ObjectID) error
+	CreateMFAChallenge(ctx context.Context, id primitive.ObjectID, expiresAt time.Time) (string, error)
+	FindUserByMFAChallenge(ctx context.Context, token string) (*DBResponse, error)
+	IncrementMFAChallengeAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error
+	UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) error
+	ClearMFAChallenge(ctx context.Context, id primitive.ObjectID) error
+	SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, hashedCodes []string) error
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hashedCode string) error
+	CreateMagicLinkToken(ctx context.Context, email string) (*DBResponse, string, error)
+	ConsumeMagicLinkToken(ctx context.Context, token string) (*DBResponse, error)
+	SetEmailOTP(ctx context.Context, id primitive.ObjectID, hashedCode string, expiresAt time.Time) error
+	IncrementEmailOTPAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error
+	ClearEmailOTP(ctx context.Context, id primitive.ObjectID) error
+	ListUsers(ctx context.Context, query *UserListQuery) ([]*DBResponse, int64, error)
+	UpdateUserRole(ctx context.Context, id primitive.ObjectID, role string) error
+	ForceVerifyUser(ctx context.Context, id primitive.ObjectID) error
+	SetUserDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error
+	RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error)
+	LockUser(ctx context.Context, id primitive.ObjectID, until time.Time) error
+	ResetFailedLogins(ctx context.Context, id primitive.ObjectID) error
+	UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error
+	UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error
+	ScheduleUserDeletion(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	CancelUserDeletion(ctx context.Context, id primitive.ObjectID) error
+	FindUsersDueForDeletion(ctx context.Context, now time.Time, limit int64) ([]*DBResponse, error)
+	MarkUserPurging(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	DeleteScheduledUser(ctx context.Context, id primitive.ObjectID, now time.Time) error
+}
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshTokenById(ctx context.Context, id primitive.ObjectID) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id primitive.ObjectID) error
+	RevokeRefreshTokenFamily(ctx context.Context, family primitive.ObjectID) error
+	RevokeUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error
+	RevokeOtherRefreshTokens(ctx context.Context, userId, family primitive.ObjectID) error
+	DeleteUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	FindSessionById(ctx context.Context, id primitive.ObjectID) (*Session, error)
+	TouchSession(ctx context.Context, id primitive.ObjectID, expiresAt time.Time, client ClientInfo) error
+	FindUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*Session, error)
+	FindAllUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*Session, error)
+	RevokeSession(ctx context.Context, id primitive.ObjectID) error
+	RevokeUserSessions(ctx context.Context, userId primitive.ObjectID) error
+	RevokeOtherSessions(ctx context.Context, userId, sessionId primitive.ObjectID) error
+	DeleteUserSessions(ctx context.Context, userId primitive.ObjectID) error
+}
+
+type WebAuthnRepository interface {
+	CreateWebAuthnChallenge(ctx context.Context, challenge *WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(ctx context.Context, challenge, challengeType string) (*WebAuthnChallenge, error)
+	CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error
+	FindWebAuthnCredentialById(ctx context.Context, credentialId []byte) (*WebAuthnCredential, error)
+	FindUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) ([]*WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id primitive.ObjectID, signCount uint32) error
+	DeleteUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) error
+}
+
+// RateLimiter takes a token for key from the bucket described by policy. When
+// the bucket is empty it reports how long the caller has to wait.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, policy RateLimitPolicy) (bool, time.Duration, error)
+}
+
+// PasswordHasher makes and checks password hashes of one algorithm. Verify
+// and NeedsRehash are only called with hashes the hasher Supports.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Supports(hash string) bool
+	Verify(hash, password string) error
+	NeedsRehash(hash string) bool
+}
+
+// BreachedPasswords returns the SHA-1 hash suffixes of breached passwords
+// with their counts for the first five hex characters of the hash, the same
+// k-anonymity scheme as the Pwned Passwords range API.
+type BreachedPasswords interface {
+	Range(prefix string) (map[string]int, error)
+}
+
+type AuditRepository interface {
+	CreateAuditEvent(ctx context.Context, event *AuditEvent) error
+	ListAuditEvents(ctx context.Context, query *AuditEventQuery) ([]*AuditEvent, int64, error)
+	AnonymizeAuditEvents(ctx context.Context, actorId primitive.ObjectID, email string) error
+	FindUserAuditEvents(ctx context.Context, actorId primitive.ObjectID) ([]*AuditEvent, error)
+}
+
+type DataExportRepository interface {
+	CreateDataExport(ctx context.Context, export *DataExport) (string, error)
+	FindDataExportByToken(ctx context.Context, token string) (*DataExport, error)
+	DeleteUserDataExports(ctx context.Context, userId primitive.ObjectID) error
 }
@@ -0,0 +1,20 @@
+package models
+
+// JWK is the public part of a token signing key in the JSON Web Key format
+// of RFC 7517. N and E are set for RSA keys, Crv and X for EC and Ed25519
+// keys and Y for EC keys only.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
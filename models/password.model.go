@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultPasswordMinLength = 8
+	// Every byte of the password counts with argon2id, but bcrypt, which can
+	// still be selected with PASSWORD_HASH_ALGORITHM, ignores everything after
+	// the first 72 bytes. Keeping that limit means a password never loses part
+	// of its strength when the hasher is switched.
+	DefaultPasswordMaxLength = 72
+
+	// passwordSimilarityMinLength keeps short names and email parts from
+	// rejecting passwords that only share a few letters with them.
+	passwordSimilarityMinLength = 3
+)
+
+// PasswordPolicy is checked on sign up, password reset and password change.
+// Breached is optional, the breached password check is skipped without it.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Denylist      []string
+	Breached      BreachedPasswords
+}
+
+// Validate returns a message for every rule the password breaks, email and
+// name are those of the user the password is for. The error is only set when
+// the breached passwords could not be looked up.
+func (p *PasswordPolicy) Validate(password, email, name string) ([]string, error) {
+	var violations []string
+
+	minLength := p.MinLength
+	if minLength <= 0 {
+		minLength = DefaultPasswordMinLength
+	}
+	maxLength := p.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultPasswordMaxLength
+	}
+
+	if utf8.RuneCountInString(password) < minLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters long", minLength))
+	}
+	if len(password) > maxLength {
+		violations = append(violations, fmt.Sprintf("password must not be longer than %d bytes", maxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+
+	for _, denied := range p.Denylist {
+		if lowered == strings.ToLower(denied) {
+			violations = append(violations, "password is too common")
+			break
+		}
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, _, _ := strings.Cut(email, "@")
+	if containsPersonalInfo(lowered, email, local) {
+		violations = append(violations, "password must not contain your email")
+	}
+	if containsPersonalInfo(lowered, strings.Fields(strings.ToLower(name))...) {
+		violations = append(violations, "password must not contain your name")
+	}
+
+	if p.Breached != nil {
+		breached, err := isBreached(p.Breached, password)
+		if err != nil {
+			return violations, err
+		}
+		if breached {
+			violations = append(violations, "password has appeared in a data breach")
+		}
+	}
+
+	return violations, nil
+}
+
+func containsPersonalInfo(password string, parts ...string) bool {
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= passwordSimilarityMinLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBreached only hands the first five characters of the hash to the
+// lookup and compares the rest itself.
+func isBreached(breached BreachedPasswords, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := breached.Range(hash[:5])
+	if err != nil {
+		return false, err
+	}
+
+	return suffixes[hash[5:]] > 0, nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RateLimitLogin          = "login"
+	RateLimitMFA            = "mfa"
+	RateLimitRegister       = "register"
+	RateLimitForgotPassword = "forgotpassword"
+	RateLimitMagicLink      = "magiclink"
+	RateLimitVerifyEmail    = "verifyemail"
+	RateLimitResendVerify   = "resendverification"
+	RateLimitEmailOTP       = "otp"
+	RateLimitEmailOTPLogin  = "otplogin"
+	RateLimitDataExport     = "dataexport"
+)
+
+// RateLimitPolicy is a token bucket holding Limit tokens that refills
+// completely over Period. Every request takes one token.
+type RateLimitPolicy struct {
+	Limit  int
+	Period time.Duration
+}
+
+// RateLimitPolicies maps a route to its policy.
+type RateLimitPolicies map[string]RateLimitPolicy
+
+var DefaultRateLimitPolicies = RateLimitPolicies{
+	RateLimitLogin:          {Limit: 10, Period: time.Minute},
+	RateLimitMFA:            {Limit: 10, Period: time.Minute},
+	RateLimitRegister:       {Limit: 5, Period: time.Hour},
+	RateLimitForgotPassword: {Limit: 5, Period: 15 * time.Minute},
+	RateLimitMagicLink:      {Limit: 5, Period: 15 * time.Minute},
+	RateLimitVerifyEmail:    {Limit: 10, Period: time.Minute},
+	RateLimitResendVerify:   {Limit: 3, Period: time.Hour},
+	RateLimitEmailOTP:       {Limit: 5, Period: 15 * time.Minute},
+	RateLimitEmailOTPLogin:  {Limit: 10, Period: time.Minute},
+	RateLimitDataExport:     {Limit: 3, Period: 24 * time.Hour},
+}
+
+// Refill returns the tokens left in a bucket after elapsed, never more than
+// the limit.
+func (p RateLimitPolicy) Refill(tokens float64, elapsed time.Duration) float64 {
+	tokens += float64(elapsed) / float64(p.Period) * float64(p.Limit)
+
+	return math.Min(tokens, float64(p.Limit))
+}
+
+// RetryAfter returns how long it takes until a bucket holding tokens has a
+// whole token again.
+func (p RateLimitPolicy) RetryAfter(tokens float64) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tokens) / float64(p.Limit) * float64(p.Period))
+}
+
+// ParseRateLimitPolicies reads policies in the form
+// "login=10/1m;forgotpassword=5/15m". Routes that are not listed keep their
+// default policy.
+func ParseRateLimitPolicies(s string) (RateLimitPolicies, error) {
+	policies := RateLimitPolicies{}
+	for route, policy := range DefaultRateLimitPolicies {
+		policies[route] = policy
+	}
+
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, value, found := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		limit, period, hasPeriod := strings.Cut(strings.TrimSpace(value), "/")
+		if !found || route == "" || !hasPeriod {
+			return nil, fmt.Errorf("invalid rate limit entry %q", entry)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid rate limit entry %q", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(period))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid rate limit entry %q", entry)
+		}
+
+		policies[route] = RateLimitPolicy{Limit: n, Period: d}
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is the server side record of an issued refresh token. The ID
+// is used as the token's "jti" claim and every token minted by rotating
+// another one shares the same Family.
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Family    primitive.ObjectID `json:"family" bson:"family"`
+	Used      bool               `json:"used" bson:"used"`
+	Revoked   bool               `json:"revoked" bson:"revoked"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionUsersDelete = "users:delete"
+	PermissionRolesWrite  = "roles:write"
+	PermissionAuditRead   = "audit:read"
+	// PermissionAll grants every permission.
+	PermissionAll = "*"
+)
+
+// RolePermissions maps a role to the permissions it grants.
+type RolePermissions map[string][]string
+
+var DefaultRolePermissions = RolePermissions{
+	RoleAdmin: {PermissionAll},
+	RoleUser:  {},
+}
+
+func (rp RolePermissions) Allows(role, permission string) bool {
+	for _, granted := range rp[role] {
+		if granted == PermissionAll || granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Covers tells whether role grants every permission of other, so a user with
+// role can hand out other without anyone gaining more than they have.
+func (rp RolePermissions) Covers(role, other string) bool {
+	for _, permission := range rp[other] {
+		if !rp.Allows(role, permission) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseRolePermissions reads a mapping in the form
+// "admin=*;support=users:read,users:write". Roles without permissions may be
+// listed as "user=".
+func ParseRolePermissions(s string) (RolePermissions, error) {
+	rp := RolePermissions{}
+
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		role, permissions, found := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !found || role == "" {
+			return nil, fmt.Errorf("invalid role permissions entry %q", entry)
+		}
+
+		rp[role] = []string{}
+		for _, permission := range strings.Split(permissions, ",") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				rp[role] = append(rp[role], permission)
+			}
+		}
+	}
+
+	return rp, nil
+}
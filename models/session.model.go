@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is created on every login. Its ID is carried in the "sid" claim of
+// the access token and is the family of the refresh tokens issued for it.
+type Session struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Device     string             `json:"device" bson:"device"`
+	UserAgent  string             `json:"user_agent" bson:"user_agent"`
+	IP         string             `json:"ip" bson:"ip"`
+	Revoked    bool               `json:"revoked" bson:"revoked"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+}
+
+// SessionResponse is a session as shown to its user. Current marks the
+// session the request was made with.
+type SessionResponse struct {
+	ID         primitive.ObjectID `json:"id"`
+	Device     string             `json:"device"`
+	UserAgent  string             `json:"user_agent"`
+	IP         string             `json:"ip"`
+	Current    bool               `json:"current"`
+	CreatedAt  time.Time          `json:"created_at"`
+	LastSeenAt time.Time          `json:"last_seen_at"`
+}
@@ -9,7 +9,7 @@ import (
 type SignUpInput struct {
 	Name            string    `json:"name" bson:"name" binding:"required"`
 	Email           string    `json:"email" bson:"email" binding:"required"`
-	Password        string    `json:"password" bson:"password" binding:"required,min=8"`
+	Password        string    `json:"password" bson:"password" binding:"required"`
 	PasswordConfirm string    `json:"passwordConfirm" bson:"passwordConfirm,omitempty" binding:"required"`
 	Role            string    `json:"role" bson:"role"`
 	Verified        bool      `json:"verified" bson:"verified"`
@@ -30,28 +30,124 @@ type DBResponse struct {
 	PasswordConfirm string             `json:"passwordConfirm" bson:"passwordConfirm,omitempty" binding:"required"`
 	Role            string             `json:"role" bson:"role"`
 	Verified        bool               `json:"verified" bson:"verified"`
+	Disabled        bool               `json:"disabled" bson:"disabled,omitempty"`
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+
+	TwoFactorEnabled     bool     `json:"two_factor_enabled" bson:"twoFactorEnabled"`
+	TwoFactorSecret      string   `json:"-" bson:"twoFactorSecret,omitempty"`
+	RecoveryCodes        []string `json:"-" bson:"recoveryCodes,omitempty"`
+	MFAChallengeAttempts int      `json:"-" bson:"mfaChallengeAttempts,omitempty"`
+	TwoFactorLastCounter int64    `json:"-" bson:"twoFactorLastCounter,omitempty"`
+
+	EmailOTPCode     string    `json:"-" bson:"emailOtpCode,omitempty"`
+	EmailOTPAt       time.Time `json:"-" bson:"emailOtpAt,omitempty"`
+	EmailOTPAttempts int       `json:"-" bson:"emailOtpAttempts,omitempty"`
+
+	FailedLoginAttempts int       `json:"-" bson:"failedLoginAttempts,omitempty"`
+	LockoutCount        int       `json:"-" bson:"lockoutCount,omitempty"`
+	LockedUntil         time.Time `json:"-" bson:"lockedUntil,omitempty"`
+
+	PendingEmail     string    `json:"-" bson:"pendingEmail,omitempty"`
+	EmailChangeToken string    `json:"-" bson:"emailChangeToken,omitempty"`
+	EmailChangeAt    time.Time `json:"-" bson:"emailChangeAt,omitempty"`
+
+	DeletionScheduledAt time.Time `json:"-" bson:"deletionScheduledAt,omitempty"`
 }
 
 type UserResponse struct {
-	ID        primitive.ObjectID `json:"_id" bson:"_id"`
-	Name      string             `json:"name" bson:"name" binding:"required"`
-	Email     string             `json:"email" bson:"email" binding:"required"`
-	Role      string             `json:"role" bson:"role"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID               primitive.ObjectID `json:"_id" bson:"_id"`
+	Name             string             `json:"name" bson:"name" binding:"required"`
+	Email            string             `json:"email" bson:"email" binding:"required"`
+	PendingEmail     string             `json:"pending_email,omitempty" bson:"pendingEmail,omitempty"`
+	Role             string             `json:"role" bson:"role"`
+	Verified         bool               `json:"verified" bson:"verified"`
+	Disabled         bool               `json:"disabled" bson:"disabled"`
+	Locked           bool               `json:"locked" bson:"locked"`
+	TwoFactorEnabled bool               `json:"two_factor_enabled" bson:"twoFactorEnabled"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// UserListQuery filters the admin user list. Email and Name match partially.
+type UserListQuery struct {
+	Email    string `form:"email"`
+	Name     string `form:"name"`
+	Role     string `form:"role"`
+	Verified *bool  `form:"verified"`
+	Page     int64  `form:"page,default=1" binding:"min=1"`
+	Limit    int64  `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+type UserListResponse struct {
+	Users []UserResponse `json:"users"`
+	Total int64          `json:"total"`
+	Page  int64          `json:"page"`
+	Limit int64          `json:"limit"`
+}
+
+type UpdateRoleInput struct {
+	Role string `json:"role" bson:"role" binding:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" bson:"email" binding:"required"`
 }
 
 type ForgetPasswordInput struct {
 	Email string `json:"email" bson:"email" binding:"required"`
 }
 
+type PasswordlessInput struct {
+	Email string `json:"email" bson:"email" binding:"required"`
+}
+
+type EmailOTPInput struct {
+	Email string `json:"email" bson:"email" binding:"required"`
+	Code  string `json:"code" bson:"code" binding:"required,len=6,numeric"`
+}
+
 type ResetPasswordInput struct {
-	Password        string `json:"password" bson:"password" binding:"required,min=8"`
+	Password        string `json:"password" bson:"password" binding:"required"`
+	PasswordConfirm string `json:"passwordConfirm" bson:"passwordConfirm,omitempty" binding:"required"`
+}
+
+// UpdateProfileInput only changes the fields that are sent. A new email is
+// pending until it has been confirmed.
+type UpdateProfileInput struct {
+	Name  *string `json:"name" bson:"name" binding:"omitempty,min=1,max=100"`
+	Email *string `json:"email" bson:"email" binding:"omitempty,email"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" bson:"password" binding:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" bson:"currentPassword" binding:"required"`
+	Password        string `json:"password" bson:"password" binding:"required"`
 	PasswordConfirm string `json:"passwordConfirm" bson:"passwordConfirm,omitempty" binding:"required"`
 }
 
+type TwoFactorCodeInput struct {
+	Code string `json:"code" bson:"code" binding:"required"`
+}
+
+type MFAChallengeInput struct {
+	MFAToken     string `json:"mfaToken" bson:"mfaToken" binding:"required"`
+	Code         string `json:"code" bson:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" bson:"recoveryCode" binding:"required_without=Code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
 type AuthServiceResponse struct {
 	User               *DBResponse
 	Status             string
@@ -60,15 +156,22 @@ type AuthServiceResponse struct {
 	StatusCode         int
 	AccessToken        string
 	RefreshAccessToken string
+	MFAToken           string
+	Data               interface{}
 }
 
 func FilteredResponse(result *DBResponse) UserResponse {
 	return UserResponse{
-		ID:        result.ID,
-		Name:      result.Name,
-		Email:     result.Email,
-		Role:      result.Role,
-		CreatedAt: result.CreatedAt,
-		UpdatedAt: result.UpdatedAt,
+		ID:               result.ID,
+		Name:             result.Name,
+		Email:            result.Email,
+		PendingEmail:     result.PendingEmail,
+		Role:             result.Role,
+		Verified:         result.Verified,
+		Disabled:         result.Disabled,
+		Locked:           result.LockedUntil.After(time.Now()),
+		TwoFactorEnabled: result.TwoFactorEnabled,
+		CreatedAt:        result.CreatedAt,
+		UpdatedAt:        result.UpdatedAt,
 	}
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebAuthnCredential is a passkey registered by a user.
+type WebAuthnCredential struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CredentialID []byte             `json:"-" bson:"credential_id"`
+	PublicKey    []byte             `json:"-" bson:"public_key"`
+	SignCount    uint32             `json:"-" bson:"sign_count"`
+	Name         string             `json:"name" bson:"name"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt   time.Time          `json:"last_used_at" bson:"last_used_at"`
+}
+
+// WebAuthnChallenge is issued with the options of a ceremony and consumed by
+// its response. UserID is empty for a usernameless sign in.
+type WebAuthnChallenge struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	Challenge string             `json:"challenge" bson:"challenge"`
+	Type      string             `json:"type" bson:"type"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnCreationOptions is the JSON form of PublicKeyCredentialCreationOptions.
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions is the JSON form of PublicKeyCredentialRequestOptions.
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+type WebAuthnLoginOptionsInput struct {
+	Email string `json:"email" bson:"email"`
+}
+
+type WebAuthnAttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AttestationObject string `json:"attestationObject" binding:"required"`
+}
+
+type WebAuthnRegistrationInput struct {
+	ID       string                      `json:"id" binding:"required"`
+	Type     string                      `json:"type" binding:"required"`
+	Name     string                      `json:"name"`
+	Response WebAuthnAttestationResponse `json:"response" binding:"required"`
+}
+
+type WebAuthnAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+type WebAuthnAssertionInput struct {
+	ID       string                    `json:"id" binding:"required"`
+	Type     string                    `json:"type" binding:"required"`
+	Response WebAuthnAssertionResponse `json:"response" binding:"required"`
+}
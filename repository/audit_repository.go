@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAuditLogRetention = 90 * 24 * time.Hour
+
+	// indexOptionsConflict is the server error when an index exists with the
+	// same keys but other options.
+	indexOptionsConflict = 85
+)
+
+type auditCollection struct {
+	DB        *mongo.Collection
+	retention time.Duration
+	index     sync.Once
+}
+
+// NewAuditRepository stores audit events, MongoDB drops them once they are
+// older than retention, 90 days when it is not set.
+func NewAuditRepository(db *mongo.Collection, retention time.Duration) models.AuditRepository {
+	if retention <= 0 {
+		retention = defaultAuditLogRetention
+	}
+
+	return &auditCollection{DB: db, retention: retention}
+}
+
+func (r *auditCollection) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if _, err := r.DB.InsertOne(ctx, event); err != nil {
+		return err
+	}
+
+	return r.createIndexes(ctx)
+}
+
+// createIndexes runs once per process. When the retention has changed since
+// the TTL index was created, the index is updated in place with collMod.
+func (r *auditCollection) createIndexes(ctx context.Context) (err error) {
+	r.index.Do(func() {
+		expireAfter := int32(r.retention.Seconds())
+
+		opt := options.Index()
+		opt.SetExpireAfterSeconds(expireAfter)
+
+		indexes := []mongo.IndexModel{
+			{Keys: bson.M{"created_at": 1}, Options: opt},
+			{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		}
+
+		_, indexErr := r.DB.Indexes().CreateMany(ctx, indexes)
+
+		var serverErr mongo.ServerError
+		if errors.As(indexErr, &serverErr) && serverErr.HasErrorCode(indexOptionsConflict) {
+			command := bson.D{
+				{Key: "collMod", Value: r.DB.Name()},
+				{Key: "index", Value: bson.D{
+					{Key: "keyPattern", Value: bson.M{"created_at": 1}},
+					{Key: "expireAfterSeconds", Value: expireAfter},
+				}},
+			}
+
+			if indexErr = r.DB.Database().RunCommand(ctx, command).Err(); indexErr == nil {
+				_, indexErr = r.DB.Indexes().CreateMany(ctx, indexes)
+			}
+		}
+
+		if indexErr != nil {
+			err = errors.New("cannot create index for created_at")
+		}
+	})
+
+	return err
+}
+
+func (r *auditCollection) ListAuditEvents(ctx context.Context, query *models.AuditEventQuery) ([]*models.AuditEvent, int64, error) {
+	filter := bson.D{}
+
+	if query.UserID != "" {
+		oid, err := primitive.ObjectIDFromHex(query.UserID)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter = append(filter, bson.E{Key: "actor_id", Value: oid})
+	}
+	if query.Type != "" {
+		filter = append(filter, bson.E{Key: "type", Value: query.Type})
+	}
+
+	total, err := r.DB.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	opt.SetSkip((query.Page - 1) * query.Limit)
+	opt.SetLimit(query.Limit)
+
+	cursor, err := r.DB.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []*models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// FindUserAuditEvents returns every event of the user, the oldest first.
+func (r *auditCollection) FindUserAuditEvents(ctx context.Context, actorId primitive.ObjectID) ([]*models.AuditEvent, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.DB.Find(ctx, bson.D{{Key: "actor_id", Value: actorId}}, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// AnonymizeAuditEvents strips the events of a deleted user of everything that
+// identifies them. The events themselves are kept for the rest of the
+// retention period.
+func (r *auditCollection) AnonymizeAuditEvents(ctx context.Context, actorId primitive.ObjectID, email string) error {
+	query := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "actor_id", Value: actorId}},
+		bson.D{{Key: "email", Value: strings.ToLower(email)}},
+	}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "ip", Value: ""}, {Key: "user_agent", Value: ""}}},
+		{Key: "$unset", Value: bson.D{{Key: "actor_id", Value: ""}, {Key: "email", Value: ""}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
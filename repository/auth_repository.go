@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/thanhpk/randstr"
@@ -16,8 +18,37 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// verificationCodeExpiresIn is how long the link in a verification email can
+// be used.
+const verificationCodeExpiresIn = 24 * time.Hour
+
+// tokenQuery matches a stored one-time token by its keyed hash, or by the
+// base64 form tokens were stored in before, so links sent before the switch
+// keep working until they expire.
+func tokenQuery(token string) (bson.D, error) {
+	hash, err := utils.HashToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.D{{Key: "$in", Value: bson.A{hash, utils.Encode(token)}}}, nil
+}
+
+// ErrTooManyAttempts is returned when a one-time code has been tried as often
+// as it may be, or has been discarded in the meantime.
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// ErrTOTPCodeUsed is returned when a code of the same or a later time step has
+// already been accepted.
+var ErrTOTPCodeUsed = errors.New("two factor code already used")
+
+// ErrRecoveryCodeUsed is returned when the recovery code is no longer stored,
+// because it has been used or the codes were regenerated.
+var ErrRecoveryCodeUsed = errors.New("recovery code already used")
+
 type authCollection struct {
-	DB *mongo.Collection
+	DB            *mongo.Collection
+	deletionIndex sync.Once
 }
 
 func NewAuthRepository(db *mongo.Collection) models.AuthRepository {
@@ -59,7 +90,10 @@ func (r *authCollection) ForgetPassword(ctx context.Context, email string) (*mod
 	}
 	resetToken := randstr.String(20)
 
-	passwordResetToken := utils.Encode(resetToken)
+	passwordResetToken, err := utils.HashToken(resetToken)
+	if err != nil {
+		return nil, "", err
+	}
 
 	query1 := bson.D{{Key: "email", Value: strings.ToLower(email)}}
 	update := bson.D{
@@ -68,7 +102,7 @@ func (r *authCollection) ForgetPassword(ctx context.Context, email string) (*mod
 			{Key: "passwordResetAt", Value: time.Now().Add(time.Minute * 15)},
 		}},
 	}
-	_, err := r.DB.UpdateOne(ctx, query1, update)
+	_, err = r.DB.UpdateOne(ctx, query1, update)
 
 	if err != nil {
 		return nil, "", err
@@ -78,20 +112,132 @@ func (r *authCollection) ForgetPassword(ctx context.Context, email string) (*mod
 
 }
 
-// func (r *authCollection) UpdateUserById(ctx context.Context, id primitive.ObjectID, field, value string) (*mongo.UpdateResult, error) {
-// 	query := bson.D{{Key: "_id", Value: id}}
-// 	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: value}}}}
-// 	result, err := r.DB.UpdateOne(ctx, query, update)
-// 	return result, err
-// }
+func (r *authCollection) CreateMagicLinkToken(ctx context.Context, email string) (*models.DBResponse, string, error) {
+	var user *models.DBResponse
+	query := bson.M{"email": strings.ToLower(email)}
+	if err := r.DB.FindOne(ctx, query).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &models.DBResponse{}, "", err
+		}
+		return nil, "", err
+	}
+	token := randstr.String(32)
+
+	magicLinkToken, err := utils.HashToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query1 := bson.D{{Key: "_id", Value: user.ID}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "magicLinkToken", Value: magicLinkToken},
+			{Key: "magicLinkAt", Value: time.Now().Add(time.Minute * 15)},
+		}},
+	}
+	_, err = r.DB.UpdateOne(ctx, query1, update)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+// ConsumeMagicLinkToken returns the owner of an unexpired magic link token
+// and removes the token in the same update so the link works only once.
+func (r *authCollection) ConsumeMagicLinkToken(ctx context.Context, token string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	tokenHash, err := tokenQuery(token)
+	if err != nil {
+		return nil, err
+	}
 
-func (r *authCollection) UpdateOne(ctx context.Context, field string, value interface{}) (*mongo.UpdateResult, error) {
-	query := bson.D{{Key: field, Value: value}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: value}}}}
+	query := bson.D{{Key: "magicLinkToken", Value: tokenHash}, {Key: "magicLinkAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "magicLinkToken", Value: ""}, {Key: "magicLinkAt", Value: ""}}}}
 
-	result, err := r.DB.UpdateOne(ctx, query, update)
+	if err := r.DB.FindOneAndUpdate(ctx, query, update).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid or expired token")
+		}
+		return nil, err
+	}
 
-	return result, err
+	return user, nil
+}
+
+// UpdateOne sets field to value on the user with the given id and returns
+// the updated user.
+func (r *authCollection) UpdateOne(ctx context.Context, id primitive.ObjectID, field string, value interface{}) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: value}, {Key: "updated_at", Value: time.Now()}}}}
+
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	if err := r.DB.FindOneAndUpdate(ctx, query, update, opt).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RequestEmailChange stores email as the pending email of the user until it
+// is confirmed with the returned token.
+func (r *authCollection) RequestEmailChange(ctx context.Context, id primitive.ObjectID, email string) (string, error) {
+	token := randstr.String(32)
+
+	emailChangeToken, err := utils.HashToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "pendingEmail", Value: strings.ToLower(email)},
+		{Key: "emailChangeToken", Value: emailChangeToken},
+		{Key: "emailChangeAt", Value: time.Now().Add(time.Hour * 24)},
+	}}}
+
+	if err := r.updateUserById(ctx, id, update); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConfirmEmailChange switches the email of the owner of an unexpired email
+// change token to the pending email. Tokens sent to the old address stop
+// working.
+func (r *authCollection) ConfirmEmailChange(ctx context.Context, token string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	tokenHash, err := tokenQuery(token)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.D{{Key: "emailChangeToken", Value: tokenHash}, {Key: "emailChangeAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "email", Value: "$pendingEmail"}, {Key: "updated_at", Value: time.Now()}}}},
+		{{Key: "$unset", Value: bson.A{
+			"pendingEmail", "emailChangeToken", "emailChangeAt",
+			"passwordResetToken", "passwordResetAt", "magicLinkToken", "magicLinkAt",
+			"emailOtpCode", "emailOtpAt", "emailOtpAttempts",
+		}}},
+	}
+
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	if err := r.DB.FindOneAndUpdate(ctx, query, update, opt).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid or expired token")
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("user with that email already exist")
+		}
+		return nil, err
+	}
+
+	return user, nil
 }
 
 func (r *authCollection) ResetPasswordToken(ctx context.Context, email, passwordResetToken string) (*mongo.UpdateResult, error) {
@@ -107,40 +253,106 @@ func (r *authCollection) ResetPasswordToken(ctx context.Context, email, password
 	return result, err
 }
 
-func (r *authCollection) VerifyEmail(ctx context.Context, verificationCode string) error {
-	query := bson.D{{Key: "verificationCode", Value: verificationCode}}
+// VerifyEmail verifies the owner of an unexpired verification code. Codes
+// issued before they had an expiry expire verificationCodeExpiresIn after
+// sign up.
+func (r *authCollection) VerifyEmail(ctx context.Context, verificationCode string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	now := time.Now()
+	tokenHash, err := tokenQuery(verificationCode)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.D{
+		{Key: "verificationCode", Value: tokenHash},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "verificationCodeAt", Value: bson.D{{Key: "$gt", Value: now}}}},
+			bson.D{
+				{Key: "verificationCodeAt", Value: bson.D{{Key: "$exists", Value: false}}},
+				{Key: "created_at", Value: bson.D{{Key: "$gt", Value: now.Add(-verificationCodeExpiresIn)}}},
+			},
+		}},
+	}
 	update := bson.D{
 		{Key: "$set", Value: bson.D{{Key: "verified", Value: true}}},
-		{Key: "$unset", Value: bson.D{{Key: "verificationCode", Value: ""}}}}
+		{Key: "$unset", Value: bson.D{{Key: "verificationCode", Value: ""}, {Key: "verificationCodeAt", Value: ""}}}}
 
-	result, err := r.DB.UpdateOne(ctx, query, update)
+	if err := r.DB.FindOneAndUpdate(ctx, query, update).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid email")
+		}
+		return nil, err
+	}
 
-	if result.MatchedCount == 0 {
-		return errors.New("invalid email")
+	return user, nil
+}
+
+// ResendVerificationCode replaces the verification code of an unverified
+// user, which also invalidates the link sent before.
+func (r *authCollection) ResendVerificationCode(ctx context.Context, email string) (*models.DBResponse, string, error) {
+	var user *models.DBResponse
+	code := randstr.String(20)
+
+	verificationCode, err := utils.HashToken(code)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return err
+	query := bson.D{{Key: "email", Value: strings.ToLower(email)}, {Key: "verified", Value: false}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "verificationCode", Value: verificationCode},
+		{Key: "verificationCodeAt", Value: time.Now().Add(verificationCodeExpiresIn)},
+	}}}
+
+	if err := r.DB.FindOneAndUpdate(ctx, query, update).Decode(&user); err != nil {
+		return nil, "", err
+	}
+
+	return user, code, nil
 }
 
-func (r *authCollection) ClearResetPasswordToken(ctx context.Context, token, password string) error {
-	hashPassword, _ := utils.HashPassword(password)
-	resetPasswordToken := utils.Encode(token)
-	query := bson.D{{Key: "passwordResetToken", Value: resetPasswordToken}, {Key: "passwordResetAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
-	update := bson.D{
-		{Key: "$set", Value: bson.D{{Key: "password", Value: hashPassword}}},
-		{Key: "$unset", Value: bson.D{{Key: "passwordResetToken", Value: ""}, {Key: "passwordResetAt", Value: ""}}}}
+func (r *authCollection) FindUserByResetToken(ctx context.Context, token string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	tokenHash, err := tokenQuery(token)
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := r.DB.UpdateOne(ctx, query, update)
+	query := bson.D{{Key: "passwordResetToken", Value: tokenHash}, {Key: "passwordResetAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+
+	if err := r.DB.FindOne(ctx, query).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid or expired token")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
 
+// ClearResetPasswordToken sets the already hashed password of the owner of an
+// unexpired reset token and removes the token.
+func (r *authCollection) ClearResetPasswordToken(ctx context.Context, token, hashedPassword string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	tokenHash, err := tokenQuery(token)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if result.MatchedCount == 0 {
-		return errors.New("invalid or expired token")
+	query := bson.D{{Key: "passwordResetToken", Value: tokenHash}, {Key: "passwordResetAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "password", Value: hashedPassword}}},
+		{Key: "$unset", Value: bson.D{{Key: "passwordResetToken", Value: ""}, {Key: "passwordResetAt", Value: ""}}}}
+
+	if err := r.DB.FindOneAndUpdate(ctx, query, update).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid or expired token")
+		}
+		return nil, err
 	}
 
-	return nil
+	return user, nil
 }
 
 func (r *authCollection) SignUpUser(ctx context.Context, user *models.SignUpInput) (*models.DBResponse, string, error) {
@@ -170,10 +382,16 @@ func (r *authCollection) SignUpUser(ctx context.Context, user *models.SignUpInpu
 	}
 
 	code := randstr.String(20)
-	verificationCode := utils.Encode(code)
+	verificationCode, err := utils.HashToken(code)
+	if err != nil {
+		return nil, "", err
+	}
 
 	query1 := bson.D{{Key: "_id", Value: newUser.ID}}
-	update := bson.D{{Key: "$set", Value: bson.D{{Key: "verificationCode", Value: verificationCode}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "verificationCode", Value: verificationCode},
+		{Key: "verificationCodeAt", Value: time.Now().Add(verificationCodeExpiresIn)},
+	}}}
 	_, err = r.DB.UpdateOne(ctx, query1, update)
 
 	if err != nil {
@@ -182,3 +400,462 @@ func (r *authCollection) SignUpUser(ctx context.Context, user *models.SignUpInpu
 
 	return newUser, code, nil
 }
+
+func (r *authCollection) SetTwoFactorSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "twoFactorSecret", Value: secret},
+			{Key: "twoFactorEnabled", Value: false},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "twoFactorLastCounter", Value: ""}}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *authCollection) EnableTwoFactor(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "twoFactorSecret", Value: bson.D{{Key: "$exists", Value: true}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "twoFactorEnabled", Value: true}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("two factor authentication has not been enrolled")
+	}
+
+	return nil
+}
+
+func (r *authCollection) DisableTwoFactor(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "twoFactorEnabled", Value: false}}},
+		{Key: "$unset", Value: bson.D{{Key: "twoFactorSecret", Value: ""}, {Key: "twoFactorLastCounter", Value: ""}, {Key: "recoveryCodes", Value: ""}}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *authCollection) CreateMFAChallenge(ctx context.Context, id primitive.ObjectID, expiresAt time.Time) (string, error) {
+	token := randstr.String(32)
+
+	mfaChallengeToken, err := utils.HashToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "mfaChallengeToken", Value: mfaChallengeToken},
+		{Key: "mfaChallengeAt", Value: expiresAt},
+		{Key: "mfaChallengeAttempts", Value: 0},
+	}}}
+
+	if _, err := r.DB.UpdateOne(ctx, query, update); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (r *authCollection) FindUserByMFAChallenge(ctx context.Context, token string) (*models.DBResponse, error) {
+	var user *models.DBResponse
+	tokenHash, err := tokenQuery(token)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.D{{Key: "mfaChallengeToken", Value: tokenHash}, {Key: "mfaChallengeAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+	if err := r.DB.FindOne(ctx, query).Decode(&user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// IncrementMFAChallengeAttempts counts an attempt before the code is compared,
+// checking the count in the same update like IncrementEmailOTPAttempts.
+func (r *authCollection) IncrementMFAChallengeAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error {
+	query := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "mfaChallengeToken", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "mfaChallengeAttempts", Value: bson.D{{Key: "$lt", Value: maxAttempts}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "mfaChallengeAttempts", Value: 1}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// UseTOTPCounter stores the time step of an accepted code. It fails when the
+// same or a later time step is stored already, so two requests with the same
+// code cannot both pass.
+func (r *authCollection) UseTOTPCounter(ctx context.Context, id primitive.ObjectID, counter int64) error {
+	query := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "twoFactorLastCounter", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "twoFactorLastCounter", Value: bson.D{{Key: "$lt", Value: counter}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "twoFactorLastCounter", Value: counter}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return ErrTOTPCodeUsed
+	}
+
+	return nil
+}
+
+func (r *authCollection) ClearMFAChallenge(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "mfaChallengeToken", Value: ""},
+		{Key: "mfaChallengeAt", Value: ""},
+		{Key: "mfaChallengeAttempts", Value: ""},
+	}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *authCollection) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, hashedCodes []string) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "recoveryCodes", Value: hashedCodes}}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *authCollection) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hashedCode string) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "recoveryCodes", Value: hashedCode}}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "recoveryCodes", Value: hashedCode}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecoveryCodeUsed
+	}
+
+	return nil
+}
+
+func (r *authCollection) SetEmailOTP(ctx context.Context, id primitive.ObjectID, hashedCode string, expiresAt time.Time) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "emailOtpCode", Value: hashedCode},
+		{Key: "emailOtpAt", Value: expiresAt},
+		{Key: "emailOtpAttempts", Value: 0},
+	}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+// IncrementEmailOTPAttempts counts an attempt before the code is compared.
+// The count is checked in the same update, so parallel requests cannot all
+// read the old count and try more codes than maxAttempts.
+func (r *authCollection) IncrementEmailOTPAttempts(ctx context.Context, id primitive.ObjectID, maxAttempts int) error {
+	query := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "emailOtpCode", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "emailOtpAttempts", Value: bson.D{{Key: "$lt", Value: maxAttempts}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "emailOtpAttempts", Value: 1}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+func (r *authCollection) ClearEmailOTP(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "emailOtpCode", Value: ""},
+		{Key: "emailOtpAt", Value: ""},
+		{Key: "emailOtpAttempts", Value: ""},
+	}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *authCollection) ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.DBResponse, int64, error) {
+	filter := bson.D{}
+
+	if query.Email != "" {
+		filter = append(filter, bson.E{Key: "email", Value: primitive.Regex{Pattern: regexp.QuoteMeta(strings.ToLower(query.Email)), Options: "i"}})
+	}
+	if query.Name != "" {
+		filter = append(filter, bson.E{Key: "name", Value: primitive.Regex{Pattern: regexp.QuoteMeta(query.Name), Options: "i"}})
+	}
+	if query.Role != "" {
+		filter = append(filter, bson.E{Key: "role", Value: query.Role})
+	}
+	if query.Verified != nil {
+		filter = append(filter, bson.E{Key: "verified", Value: *query.Verified})
+	}
+
+	total, err := r.DB.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	opt.SetSkip((query.Page - 1) * query.Limit)
+	opt.SetLimit(query.Limit)
+
+	cursor, err := r.DB.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []*models.DBResponse{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (r *authCollection) UpdateUserRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: role}, {Key: "updated_at", Value: time.Now()}}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+func (r *authCollection) ForceVerifyUser(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "verified", Value: true}, {Key: "updated_at", Value: time.Now()}}},
+		{Key: "$unset", Value: bson.D{{Key: "verificationCode", Value: ""}}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+// UpdatePassword replaces the password hash and drops a pending reset token,
+// which was issued for the old password.
+func (r *authCollection) UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "password", Value: hashedPassword}, {Key: "updated_at", Value: time.Now()}}},
+		{Key: "$unset", Value: bson.D{{Key: "passwordResetToken", Value: ""}, {Key: "passwordResetAt", Value: ""}}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+// UpdatePasswordHash swaps the hash of an unchanged password, it does nothing
+// when the password was changed since oldHash was read.
+func (r *authCollection) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "password", Value: oldHash}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: newHash}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *authCollection) SetUserDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "disabled", Value: disabled}, {Key: "updated_at", Value: time.Now()}}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+// ScheduleUserDeletion marks the user for deletion once at has passed.
+func (r *authCollection) ScheduleUserDeletion(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletionScheduledAt", Value: at}, {Key: "updated_at", Value: time.Now()}}}}
+
+	if err := r.updateUserById(ctx, id, update); err != nil {
+		return err
+	}
+
+	return r.createDeletionIndex(ctx)
+}
+
+func (r *authCollection) createDeletionIndex(ctx context.Context) (err error) {
+	r.deletionIndex.Do(func() {
+		opt := options.Index()
+		opt.SetSparse(true)
+
+		index := mongo.IndexModel{Keys: bson.M{"deletionScheduledAt": 1}, Options: opt}
+
+		if _, indexErr := r.DB.Indexes().CreateOne(ctx, index); indexErr != nil {
+			err = errors.New("cannot create index for deletionScheduledAt")
+		}
+	})
+
+	return err
+}
+
+// CancelUserDeletion fails with mongo.ErrNoDocuments once the purge of the
+// user has started.
+func (r *authCollection) CancelUserDeletion(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "deletionPurging", Value: bson.D{{Key: "$ne", Value: true}}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+		{Key: "$unset", Value: bson.D{{Key: "deletionScheduledAt", Value: ""}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// FindUsersDueForDeletion returns up to limit users whose deletion was
+// scheduled before now.
+func (r *authCollection) FindUsersDueForDeletion(ctx context.Context, now time.Time, limit int64) ([]*models.DBResponse, error) {
+	query := bson.D{{Key: "deletionScheduledAt", Value: bson.D{{Key: "$lte", Value: now}}}}
+
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "deletionScheduledAt", Value: 1}})
+	opt.SetLimit(limit)
+
+	cursor, err := r.DB.Find(ctx, query, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*models.DBResponse{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// MarkUserPurging starts the purge of a user whose deletion is still due, so
+// a login that cancelled it in the meantime wins. From then on the deletion
+// can no longer be cancelled and the purge is retried until it completes.
+func (r *authCollection) MarkUserPurging(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "deletionScheduledAt", Value: bson.D{{Key: "$lte", Value: now}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletionPurging", Value: true}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteScheduledUser deletes the user only while its deletion is still due.
+func (r *authCollection) DeleteScheduledUser(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "deletionScheduledAt", Value: bson.D{{Key: "$lte", Value: now}}}}
+
+	result, err := r.DB.DeleteOne(ctx, query)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RecordFailedLogin counts a failed password attempt and returns the number
+// of failed attempts since the last successful login or lockout.
+func (r *authCollection) RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error) {
+	var user *models.DBResponse
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "failedLoginAttempts", Value: 1}}}}
+
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	if err := r.DB.FindOneAndUpdate(ctx, query, update, opt).Decode(&user); err != nil {
+		return 0, err
+	}
+
+	return user.FailedLoginAttempts, nil
+}
+
+func (r *authCollection) LockUser(ctx context.Context, id primitive.ObjectID, until time.Time) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "lockedUntil", Value: until}, {Key: "failedLoginAttempts", Value: 0}}},
+		{Key: "$inc", Value: bson.D{{Key: "lockoutCount", Value: 1}}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+func (r *authCollection) ResetFailedLogins(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "failedLoginAttempts", Value: ""},
+		{Key: "lockoutCount", Value: ""},
+		{Key: "lockedUntil", Value: ""},
+	}}}
+
+	return r.updateUserById(ctx, id, update)
+}
+
+// updateUserById applies update to the user and reports mongo.ErrNoDocuments
+// when there is no user with that id.
+func (r *authCollection) updateUserById(ctx context.Context, id primitive.ObjectID, update bson.D) error {
+	result, err := r.DB.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type dataExportCollection struct {
+	DB    *mongo.Collection
+	index sync.Once
+}
+
+// NewDataExportRepository stores generated exports until their download link
+// expires.
+func NewDataExportRepository(db *mongo.Collection) models.DataExportRepository {
+	return &dataExportCollection{DB: db}
+}
+
+// CreateDataExport stores the export and returns the token of its download
+// link.
+func (r *dataExportCollection) CreateDataExport(ctx context.Context, export *models.DataExport) (string, error) {
+	token := randstr.String(32)
+
+	hash, err := utils.HashToken(token)
+	if err != nil {
+		return "", err
+	}
+	export.Token = hash
+
+	if _, err := r.DB.InsertOne(ctx, export); err != nil {
+		return "", err
+	}
+
+	if err := r.createIndexes(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (r *dataExportCollection) createIndexes(ctx context.Context) (err error) {
+	r.index.Do(func() {
+		opt := options.Index()
+		opt.SetExpireAfterSeconds(0)
+
+		indexes := []mongo.IndexModel{
+			{Keys: bson.M{"expires_at": 1}, Options: opt},
+			{Keys: bson.M{"token": 1}, Options: options.Index().SetUnique(true)},
+		}
+
+		if _, indexErr := r.DB.Indexes().CreateMany(ctx, indexes); indexErr != nil {
+			err = errors.New("cannot create index for expires_at")
+		}
+	})
+
+	return err
+}
+
+// FindDataExportByToken returns the export the unexpired link token belongs
+// to.
+func (r *dataExportCollection) FindDataExportByToken(ctx context.Context, token string) (*models.DataExport, error) {
+	var export *models.DataExport
+	tokenHash, err := tokenQuery(token)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.D{{Key: "token", Value: tokenHash}, {Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+
+	if err := r.DB.FindOne(ctx, query).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (r *dataExportCollection) DeleteUserDataExports(ctx context.Context, userId primitive.ObjectID) error {
+	_, err := r.DB.DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type rateLimitCollection struct {
+	DB    *mongo.Collection
+	index sync.Once
+}
+
+type rateLimitBucket struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+// NewRateLimitRepository keeps the buckets in MongoDB so that every replica
+// shares the same counters.
+func NewRateLimitRepository(db *mongo.Collection) models.RateLimiter {
+	return &rateLimitCollection{DB: db}
+}
+
+// Allow refills and takes from the bucket in a single update, so concurrent
+// requests on different replicas cannot take the same token.
+func (r *rateLimitCollection) Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (bool, time.Duration, error) {
+	now := time.Now()
+	limit := float64(policy.Limit)
+	tokensPerMillisecond := limit / float64(policy.Period.Milliseconds())
+
+	refilled := bson.D{{Key: "$min", Value: bson.A{
+		limit,
+		bson.D{{Key: "$add", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", limit}}},
+			bson.D{{Key: "$multiply", Value: bson.A{
+				bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$updated_at", now}}}}}},
+				tokensPerMillisecond,
+			}}},
+		}}},
+	}}}
+	hasToken := bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: refilled},
+			{Key: "updated_at", Value: now},
+			{Key: "expires_at", Value: now.Add(policy.Period)},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "allowed", Value: hasToken},
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{hasToken, bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens"}}}},
+		}}},
+	}
+
+	opt := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var bucket rateLimitBucket
+	if err := r.DB.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opt).Decode(&bucket); err != nil {
+		return false, 0, err
+	}
+
+	if err := r.createIndex(ctx); err != nil {
+		return false, 0, err
+	}
+
+	if !bucket.Allowed {
+		return false, policy.RetryAfter(bucket.Tokens), nil
+	}
+
+	return true, 0, nil
+}
+
+func (r *rateLimitCollection) createIndex(ctx context.Context) (err error) {
+	r.index.Do(func() {
+		opt := options.Index()
+		opt.SetExpireAfterSeconds(0)
+
+		index := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: opt}
+
+		if _, indexErr := r.DB.Indexes().CreateOne(ctx, index); indexErr != nil {
+			err = errors.New("cannot create index for expires_at")
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRefreshTokenUsed is returned when the refresh token has already been
+// exchanged or revoked.
+var ErrRefreshTokenUsed = errors.New("refresh token already used")
+
+type refreshTokenCollection struct {
+	DB    *mongo.Collection
+	index sync.Once
+}
+
+func NewRefreshTokenRepository(db *mongo.Collection) models.RefreshTokenRepository {
+	return &refreshTokenCollection{DB: db}
+}
+
+func (r *refreshTokenCollection) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if _, err := r.DB.InsertOne(ctx, token); err != nil {
+		return err
+	}
+
+	return r.createIndex(ctx)
+}
+
+func (r *refreshTokenCollection) createIndex(ctx context.Context) (err error) {
+	r.index.Do(func() {
+		opt := options.Index()
+		opt.SetExpireAfterSeconds(0)
+
+		index := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: opt}
+
+		if _, indexErr := r.DB.Indexes().CreateOne(ctx, index); indexErr != nil {
+			err = errors.New("cannot create index for expires_at")
+		}
+	})
+
+	return err
+}
+
+func (r *refreshTokenCollection) FindRefreshTokenById(ctx context.Context, id primitive.ObjectID) (*models.RefreshToken, error) {
+	var token *models.RefreshToken
+	query := bson.M{"_id": id}
+	if err := r.DB.FindOne(ctx, query).Decode(&token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *refreshTokenCollection) MarkRefreshTokenUsed(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}, {Key: "used", Value: false}, {Key: "revoked", Value: false}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: true}, {Key: "used_at", Value: time.Now()}}}}
+
+	result, err := r.DB.UpdateOne(ctx, query, update)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRefreshTokenUsed
+	}
+
+	return nil
+}
+
+func (r *refreshTokenCollection) RevokeRefreshTokenFamily(ctx context.Context, family primitive.ObjectID) error {
+	query := bson.D{{Key: "family", Value: family}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
+
+func (r *refreshTokenCollection) RevokeUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error {
+	query := bson.D{{Key: "user_id", Value: userId}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
+
+// RevokeOtherRefreshTokens revokes the refresh tokens of the user except the
+// ones of family.
+func (r *refreshTokenCollection) RevokeOtherRefreshTokens(ctx context.Context, userId, family primitive.ObjectID) error {
+	query := bson.D{{Key: "user_id", Value: userId}, {Key: "family", Value: bson.D{{Key: "$ne", Value: family}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
+
+func (r *refreshTokenCollection) DeleteUserRefreshTokens(ctx context.Context, userId primitive.ObjectID) error {
+	_, err := r.DB.DeleteMany(ctx, bson.D{{Key: "user_id", Value: userId}})
+
+	return err
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type sessionCollection struct {
+	DB    *mongo.Collection
+	index sync.Once
+}
+
+func NewSessionRepository(db *mongo.Collection) models.SessionRepository {
+	return &sessionCollection{DB: db}
+}
+
+func (r *sessionCollection) CreateSession(ctx context.Context, session *models.Session) error {
+	if _, err := r.DB.InsertOne(ctx, session); err != nil {
+		return err
+	}
+
+	return r.createIndex(ctx)
+}
+
+func (r *sessionCollection) createIndex(ctx context.Context) (err error) {
+	r.index.Do(func() {
+		opt := options.Index()
+		opt.SetExpireAfterSeconds(0)
+
+		index := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: opt}
+
+		if _, indexErr := r.DB.Indexes().CreateOne(ctx, index); indexErr != nil {
+			err = errors.New("cannot create index for expires_at")
+		}
+	})
+
+	return err
+}
+
+func (r *sessionCollection) FindSessionById(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	var session *models.Session
+	query := bson.M{"_id": id}
+	if err := r.DB.FindOne(ctx, query).Decode(&session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// TouchSession extends the session and records that the client was last seen
+// now from its current IP.
+func (r *sessionCollection) TouchSession(ctx context.Context, id primitive.ObjectID, expiresAt time.Time, client models.ClientInfo) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "expires_at", Value: expiresAt},
+		{Key: "last_seen_at", Value: time.Now()},
+		{Key: "ip", Value: client.IP},
+	}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+// FindUserSessions returns the sessions of the user that can still be used,
+// the most recently seen first.
+func (r *sessionCollection) FindUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*models.Session, error) {
+	query := bson.D{
+		{Key: "user_id", Value: userId},
+		{Key: "revoked", Value: false},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.DB.Find(ctx, query, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// FindAllUserSessions returns every stored session of the user, revoked ones
+// included, the oldest first.
+func (r *sessionCollection) FindAllUserSessions(ctx context.Context, userId primitive.ObjectID) ([]*models.Session, error) {
+	opt := options.Find()
+	opt.SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.DB.Find(ctx, bson.D{{Key: "user_id", Value: userId}}, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *sessionCollection) RevokeSession(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *sessionCollection) RevokeUserSessions(ctx context.Context, userId primitive.ObjectID) error {
+	query := bson.D{{Key: "user_id", Value: userId}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
+
+// RevokeOtherSessions revokes the sessions of the user except sessionId.
+func (r *sessionCollection) RevokeOtherSessions(ctx context.Context, userId, sessionId primitive.ObjectID) error {
+	query := bson.D{{Key: "user_id", Value: userId}, {Key: "_id", Value: bson.D{{Key: "$ne", Value: sessionId}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+
+	_, err := r.DB.UpdateMany(ctx, query, update)
+
+	return err
+}
+
+func (r *sessionCollection) DeleteUserSessions(ctx context.Context, userId primitive.ObjectID) error {
+	_, err := r.DB.DeleteMany(ctx, bson.D{{Key: "user_id", Value: userId}})
+
+	return err
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type webAuthnCollection struct {
+	Credentials *mongo.Collection
+	Challenges  *mongo.Collection
+}
+
+func NewWebAuthnRepository(credentials *mongo.Collection, challenges *mongo.Collection) models.WebAuthnRepository {
+	return &webAuthnCollection{Credentials: credentials, Challenges: challenges}
+}
+
+func (r *webAuthnCollection) CreateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	if _, err := r.Challenges.InsertOne(ctx, challenge); err != nil {
+		return err
+	}
+
+	opt := options.Index()
+	opt.SetExpireAfterSeconds(0)
+
+	index := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: opt}
+
+	if _, err := r.Challenges.Indexes().CreateOne(ctx, index); err != nil {
+		return errors.New("cannot create index for expires_at")
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge deletes the challenge so that every challenge can
+// only be answered once.
+func (r *webAuthnCollection) ConsumeWebAuthnChallenge(ctx context.Context, challenge, challengeType string) (*models.WebAuthnChallenge, error) {
+	var result *models.WebAuthnChallenge
+	query := bson.D{
+		{Key: "challenge", Value: challenge},
+		{Key: "type", Value: challengeType},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	if err := r.Challenges.FindOneAndDelete(ctx, query).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *webAuthnCollection) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	if _, err := r.Credentials.InsertOne(ctx, credential); err != nil {
+		if er, ok := err.(mongo.WriteException); ok && er.WriteErrors[0].Code == 11000 {
+			return errors.New("credential already registered")
+		}
+		return err
+	}
+
+	opt := options.Index()
+	opt.SetUnique(true)
+
+	index := mongo.IndexModel{Keys: bson.M{"credential_id": 1}, Options: opt}
+
+	if _, err := r.Credentials.Indexes().CreateOne(ctx, index); err != nil {
+		return errors.New("cannot create index for credential_id")
+	}
+
+	return nil
+}
+
+func (r *webAuthnCollection) FindWebAuthnCredentialById(ctx context.Context, credentialId []byte) (*models.WebAuthnCredential, error) {
+	var credential *models.WebAuthnCredential
+	query := bson.M{"credential_id": credentialId}
+	if err := r.Credentials.FindOne(ctx, query).Decode(&credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (r *webAuthnCollection) FindUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) ([]*models.WebAuthnCredential, error) {
+	credentials := []*models.WebAuthnCredential{}
+	query := bson.M{"user_id": userId}
+
+	cursor, err := r.Credentials.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (r *webAuthnCollection) UpdateWebAuthnSignCount(ctx context.Context, id primitive.ObjectID, signCount uint32) error {
+	query := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "sign_count", Value: signCount}, {Key: "last_used_at", Value: time.Now()}}}}
+
+	_, err := r.Credentials.UpdateOne(ctx, query, update)
+
+	return err
+}
+
+func (r *webAuthnCollection) DeleteUserWebAuthnCredentials(ctx context.Context, userId primitive.ObjectID) error {
+	_, err := r.Credentials.DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/controllers"
+	"github.com/tonybobo/auth-template/middleware"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+)
+
+type AdminRouteController struct {
+	adminController controllers.AdminController
+}
+
+func NewAdminRouteController(adminController controllers.AdminController) AdminRouteController {
+	return AdminRouteController{adminController}
+}
+
+func (ac *AdminRouteController) AdminRoute(rg *gin.RouterGroup, userService services.UserService) {
+	admin := rg.Group("/admin")
+	admin.Use(middleware.DeserializeUser(userService))
+	router := admin.Group("/users")
+
+	read := middleware.RequirePermission(models.PermissionUsersRead)
+	write := middleware.RequirePermission(models.PermissionUsersWrite)
+	roles := middleware.RequirePermission(models.PermissionUsersWrite, models.PermissionRolesWrite)
+	remove := middleware.RequirePermission(models.PermissionUsersDelete)
+	audit := middleware.RequirePermission(models.PermissionAuditRead)
+
+	router.GET("", read, ac.adminController.ListUsers)
+	router.GET("/:id", read, ac.adminController.GetUser)
+	router.PATCH("/:id/role", roles, ac.adminController.UpdateUserRole)
+	router.POST("/:id/verify", write, ac.adminController.VerifyUser)
+	router.POST("/:id/disable", write, ac.adminController.DisableUser)
+	router.POST("/:id/enable", write, ac.adminController.EnableUser)
+	router.POST("/:id/unlock", write, ac.adminController.UnlockUser)
+	router.DELETE("/:id", remove, ac.adminController.DeleteUser)
+
+	admin.GET("/audit", audit, ac.adminController.ListAuditEvents)
+}
@@ -2,28 +2,45 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/controllers"
 	"github.com/tonybobo/auth-template/middleware"
+	"github.com/tonybobo/auth-template/models"
 	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
 )
 
 type AuthRouteController struct {
 	authController controllers.AuthController
+	rateLimiter    models.RateLimiter
 }
 
-func NewAuthRouteController(authController controllers.AuthController) AuthRouteController {
-	return AuthRouteController{authController}
+func NewAuthRouteController(authController controllers.AuthController, rateLimiter models.RateLimiter) AuthRouteController {
+	return AuthRouteController{authController, rateLimiter}
 }
 
 func (rc *AuthRouteController) AuthRoute(rg *gin.RouterGroup, userService services.UserService) {
 	router := rg.Group("/auth")
+	config, _ := config.LoadConfig(".")
+	policies := utils.LoadRateLimitPolicies()
+	rateLimit := func(route string) gin.HandlerFunc {
+		return middleware.RateLimit(rc.rateLimiter, route, policies[route], config.RateLimitFailOpen)
+	}
 
 	router.GET("/test", rc.authController.Test)
-	router.POST("/register", rc.authController.SignUpUser)
-	router.POST("/login", rc.authController.SignInUser)
+	router.POST("/register", rateLimit(models.RateLimitRegister), rc.authController.SignUpUser)
+	router.POST("/login", rateLimit(models.RateLimitLogin), rc.authController.SignInUser)
+	router.POST("/login/mfa", rateLimit(models.RateLimitMFA), rc.authController.VerifyMFA)
+	router.POST("/magic-link", rateLimit(models.RateLimitMagicLink), rc.authController.RequestMagicLink)
+	router.GET("/magic-link/:token", rc.authController.SignInWithMagicLink)
+	router.POST("/otp", rateLimit(models.RateLimitEmailOTP), rc.authController.RequestEmailOTP)
+	router.POST("/login/otp", rateLimit(models.RateLimitEmailOTPLogin), rc.authController.SignInWithEmailOTP)
 	router.GET("/refresh", rc.authController.RefreshAccessToken)
-	router.GET("/logout", middleware.DeserializeUser(userService), rc.authController.LogoutUser)
-	router.GET("/verifyemail/:verificationCode", rc.authController.VerifyEmail)
-	router.POST("/forgotpassword", rc.authController.ForgetPassword)
+	router.GET("/logout", rc.authController.LogoutRefreshToken, middleware.DeserializeUser(userService), rc.authController.LogoutUser)
+	router.GET("/logout/all", middleware.DeserializeUser(userService), rc.authController.LogoutEverywhere)
+	router.GET("/verifyemail/:verificationCode", rateLimit(models.RateLimitVerifyEmail), rc.authController.VerifyEmail)
+	router.POST("/resend-verification", rateLimit(models.RateLimitResendVerify), rc.authController.ResendVerification)
+	router.GET("/confirm-email/:token", rc.authController.ConfirmEmailChange)
+	router.POST("/forgotpassword", rateLimit(models.RateLimitForgotPassword), rc.authController.ForgetPassword)
 	router.PATCH("/resetpassword/:resetToken", rc.authController.ResetPassword)
 }
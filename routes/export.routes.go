@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/controllers"
+	"github.com/tonybobo/auth-template/middleware"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+type ExportRouteController struct {
+	exportController controllers.ExportController
+	rateLimiter      models.RateLimiter
+}
+
+func NewExportRouteController(exportController controllers.ExportController, rateLimiter models.RateLimiter) ExportRouteController {
+	return ExportRouteController{exportController, rateLimiter}
+}
+
+// ExportRoute serves the download links without a session, so they work from
+// the email. The token in the link is the only credential. Every export is
+// built in the background, so requests are limited per user.
+func (ec *ExportRouteController) ExportRoute(rg *gin.RouterGroup, userService services.UserService) {
+	router := rg.Group("users")
+	config, _ := config.LoadConfig(".")
+	policies := utils.LoadRateLimitPolicies()
+	rateLimit := middleware.RateLimit(ec.rateLimiter, models.RateLimitDataExport, policies[models.RateLimitDataExport], config.RateLimitFailOpen)
+
+	router.GET("/me/export", middleware.DeserializeUser(userService), rateLimit, ec.exportController.RequestExport)
+	router.GET("/exports/:token", ec.exportController.DownloadExport)
+}
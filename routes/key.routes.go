@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/controllers"
+)
+
+type KeyRouteController struct {
+	keyController controllers.KeyController
+}
+
+func NewKeyRouteController(keyController controllers.KeyController) KeyRouteController {
+	return KeyRouteController{keyController}
+}
+
+// KeyRoute is registered on the root of the server, /.well-known is not under
+// /api.
+func (kc *KeyRouteController) KeyRoute(rg *gin.RouterGroup) {
+	router := rg.Group(".well-known")
+
+	router.GET("/jwks.json", kc.keyController.JWKS)
+}
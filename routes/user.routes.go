@@ -19,4 +19,13 @@ func (uc *UserRouteController) UserRoute(rg *gin.RouterGroup, userService servic
 	router := rg.Group("users")
 	router.Use(middleware.DeserializeUser(userService))
 	router.GET("/me", uc.userController.GetMe)
+	router.PATCH("/me", uc.userController.UpdateProfile)
+	router.DELETE("/me", uc.userController.DeleteAccount)
+	router.PATCH("/me/password", uc.userController.ChangePassword)
+	router.GET("/me/sessions", uc.userController.ListSessions)
+	router.DELETE("/me/sessions/:id", uc.userController.RevokeSession)
+	router.POST("/me/2fa/enroll", uc.userController.EnrollTwoFactor)
+	router.POST("/me/2fa/confirm", uc.userController.ConfirmTwoFactor)
+	router.POST("/me/2fa/disable", uc.userController.DisableTwoFactor)
+	router.POST("/me/2fa/recovery-codes", uc.userController.RegenerateRecoveryCodes)
 }
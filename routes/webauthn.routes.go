@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tonybobo/auth-template/controllers"
+	"github.com/tonybobo/auth-template/middleware"
+	"github.com/tonybobo/auth-template/services"
+)
+
+type WebAuthnRouteController struct {
+	webAuthnController controllers.WebAuthnController
+}
+
+func NewWebAuthnRouteController(webAuthnController controllers.WebAuthnController) WebAuthnRouteController {
+	return WebAuthnRouteController{webAuthnController}
+}
+
+func (wc *WebAuthnRouteController) WebAuthnRoute(rg *gin.RouterGroup, userService services.UserService) {
+	router := rg.Group("/auth/webauthn")
+
+	router.POST("/register/options", middleware.DeserializeUser(userService), wc.webAuthnController.BeginRegistration)
+	router.POST("/register", middleware.DeserializeUser(userService), wc.webAuthnController.FinishRegistration)
+	router.POST("/login/options", wc.webAuthnController.BeginLogin)
+	router.POST("/login", wc.webAuthnController.FinishLogin)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+	defaultAccountDeletionInterval    = time.Hour
+	accountDeletionBatchSize          = 100
+)
+
+func accountDeletionGracePeriod() time.Duration {
+	config, _ := config.LoadConfig(".")
+
+	if config.AccountDeletionGracePeriod <= 0 {
+		return defaultAccountDeletionGracePeriod
+	}
+
+	return config.AccountDeletionGracePeriod
+}
+
+// cancelAccountDeletion is called when a user signs in, which cancels a
+// deletion they asked for during the grace period. It is too late once the
+// purge has started.
+func cancelAccountDeletion(ctx context.Context, repo models.AuthRepository, user *models.DBResponse) error {
+	if user.DeletionScheduledAt.IsZero() {
+		return nil
+	}
+
+	if err := repo.CancelUserDeletion(ctx, user.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("this account has been deleted")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// AccountDeletionWorker deletes the accounts whose grace period has passed
+// together with their sessions, refresh tokens, passkeys and data exports.
+// Their audit events are kept but anonymized.
+type AccountDeletionWorker struct {
+	AuthRepository         models.AuthRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	SessionRepository      models.SessionRepository
+	WebAuthnRepository     models.WebAuthnRepository
+	AuditRepository        models.AuditRepository
+	DataExportRepository   models.DataExportRepository
+	ctx                    context.Context
+}
+
+func NewAccountDeletionWorker(AuthRepository models.AuthRepository, RefreshTokenRepository models.RefreshTokenRepository, SessionRepository models.SessionRepository, WebAuthnRepository models.WebAuthnRepository, AuditRepository models.AuditRepository, DataExportRepository models.DataExportRepository, ctx context.Context) *AccountDeletionWorker {
+	return &AccountDeletionWorker{AuthRepository, RefreshTokenRepository, SessionRepository, WebAuthnRepository, AuditRepository, DataExportRepository, ctx}
+}
+
+// Run purges the due accounts every interval, every hour when it is not set,
+// until the context of the worker is done.
+func (w *AccountDeletionWorker) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultAccountDeletionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := w.PurgeDueAccounts(); err != nil {
+			log.Println("could not delete accounts", err)
+		} else if deleted > 0 {
+			log.Println("deleted accounts", deleted)
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDueAccounts deletes the accounts that are due and returns how many
+// were deleted. An account that fails is skipped and the first error is
+// returned once the others have been handled.
+func (w *AccountDeletionWorker) PurgeDueAccounts() (int, error) {
+	now := time.Now()
+
+	users, err := w.AuthRepository.FindUsersDueForDeletion(w.ctx, now, accountDeletionBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	var firstErr error
+
+	for _, user := range users {
+		if err := w.purgeAccount(user, now); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, firstErr
+}
+
+// purgeAccount marks the user first, so a sign in that cancelled the deletion
+// in the meantime keeps the account and everything linked to it. The user is
+// deleted last, so when a step fails the account is still due and the next
+// run starts over.
+func (w *AccountDeletionWorker) purgeAccount(user *models.DBResponse, now time.Time) error {
+	if err := w.AuthRepository.MarkUserPurging(w.ctx, user.ID, now); err != nil {
+		return err
+	}
+
+	if err := w.SessionRepository.DeleteUserSessions(w.ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := w.RefreshTokenRepository.DeleteUserRefreshTokens(w.ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := w.WebAuthnRepository.DeleteUserWebAuthnCredentials(w.ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := w.DataExportRepository.DeleteUserDataExports(w.ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := w.AuditRepository.AnonymizeAuditEvents(w.ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+
+	return w.AuthRepository.DeleteScheduledUser(w.ctx, user.ID, now)
+}
@@ -0,0 +1,14 @@
+package services
+
+import "github.com/tonybobo/auth-template/models"
+
+type AdminService interface {
+	ListUsers(query *models.UserListQuery) *models.AuthServiceResponse
+	GetUser(id string) *models.AuthServiceResponse
+	UpdateUserRole(admin *models.DBResponse, id string, role string) *models.AuthServiceResponse
+	VerifyUser(id string) *models.AuthServiceResponse
+	SetUserDisabled(admin *models.DBResponse, id string, disabled bool) *models.AuthServiceResponse
+	UnlockUser(id string) *models.AuthServiceResponse
+	DeleteUser(admin *models.DBResponse, id string) *models.AuthServiceResponse
+	ListAuditEvents(query *models.AuditEventQuery) *models.AuthServiceResponse
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AdminServiceImpl struct {
+	AuthRepository         models.AuthRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	SessionRepository      models.SessionRepository
+	AuditRepository        models.AuditRepository
+	AccountDeletionWorker  *AccountDeletionWorker
+	ctx                    context.Context
+}
+
+func NewAdminService(AuthRepository models.AuthRepository, RefreshTokenRepository models.RefreshTokenRepository, SessionRepository models.SessionRepository, AuditRepository models.AuditRepository, AccountDeletionWorker *AccountDeletionWorker, ctx context.Context) AdminService {
+	return &AdminServiceImpl{AuthRepository, RefreshTokenRepository, SessionRepository, AuditRepository, AccountDeletionWorker, ctx}
+}
+
+func (as *AdminServiceImpl) ListUsers(query *models.UserListQuery) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	users, total, err := as.AuthRepository.ListUsers(as.ctx, query)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	filtered := make([]models.UserResponse, len(users))
+	for i, user := range users {
+		filtered[i] = models.FilteredResponse(user)
+	}
+
+	response.Data = models.UserListResponse{Users: filtered, Total: total, Page: query.Page, Limit: query.Limit}
+
+	return response
+}
+
+func (as *AdminServiceImpl) GetUser(id string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return userNotFound(response)
+	}
+
+	user, err := as.AuthRepository.FindUserById(as.ctx, oid)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return userNotFound(response)
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = models.FilteredResponse(user)
+
+	return response
+}
+
+func (as *AdminServiceImpl) UpdateUserRole(admin *models.DBResponse, id string, role string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "User role updated",
+	}
+
+	rolePermissions := utils.LoadRolePermissions()
+
+	if _, ok := rolePermissions[role]; !ok {
+		response.Err = errors.New("unknown role " + role)
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	// Nobody can grant a role with permissions they do not have themselves.
+	if admin == nil || !rolePermissions.Covers(admin.Role, role) {
+		response.Err = errors.New("you cannot grant a role with more permissions than your own")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusForbidden
+		return response
+	}
+
+	// Tokens issued before keep the old role in their claims, so the user has
+	// to sign in again.
+	return as.updateUser(response, admin, id, func(user *models.DBResponse) error {
+		if err := as.AuthRepository.UpdateUserRole(as.ctx, user.ID, role); err != nil {
+			return err
+		}
+
+		return as.revokeUserSessions(user.ID)
+	})
+}
+
+func (as *AdminServiceImpl) VerifyUser(id string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "User verified",
+	}
+
+	return as.updateUser(response, nil, id, func(user *models.DBResponse) error {
+		return as.AuthRepository.ForceVerifyUser(as.ctx, user.ID)
+	})
+}
+
+// SetUserDisabled disables or enables the account. Disabling also ends every
+// session of the user so existing tokens stop working straight away.
+func (as *AdminServiceImpl) SetUserDisabled(admin *models.DBResponse, id string, disabled bool) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "User enabled",
+	}
+
+	if disabled {
+		response.Message = "User disabled"
+	}
+
+	return as.updateUser(response, admin, id, func(user *models.DBResponse) error {
+		if err := as.AuthRepository.SetUserDisabled(as.ctx, user.ID, disabled); err != nil {
+			return err
+		}
+
+		if !disabled {
+			return nil
+		}
+
+		return as.revokeUserSessions(user.ID)
+	})
+}
+
+func (as *AdminServiceImpl) UnlockUser(id string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "User unlocked",
+	}
+
+	return as.updateUser(response, nil, id, func(user *models.DBResponse) error {
+		return as.AuthRepository.ResetFailedLogins(as.ctx, user.ID)
+	})
+}
+
+// DeleteUser schedules the deletion for now and purges the account the way
+// the AccountDeletionWorker does once a grace period has passed. When a step
+// fails the account stays due, so the worker finishes the purge later.
+func (as *AdminServiceImpl) DeleteUser(admin *models.DBResponse, id string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "User deleted",
+	}
+
+	return as.updateUser(response, admin, id, func(user *models.DBResponse) error {
+		now := time.Now()
+
+		if err := as.AuthRepository.ScheduleUserDeletion(as.ctx, user.ID, now); err != nil {
+			return err
+		}
+
+		return as.AccountDeletionWorker.purgeAccount(user, now)
+	})
+}
+
+func (as *AdminServiceImpl) ListAuditEvents(query *models.AuditEventQuery) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	if query.UserID != "" {
+		if _, err := primitive.ObjectIDFromHex(query.UserID); err != nil {
+			response.Err = errors.New("invalid user id")
+			response.Message = response.Err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusBadRequest
+			return response
+		}
+	}
+
+	events, total, err := as.AuditRepository.ListAuditEvents(as.ctx, query)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = models.AuditEventListResponse{Events: events, Total: total, Page: query.Page, Limit: query.Limit}
+
+	return response
+}
+
+// updateUser runs update for the user with the given id and returns the
+// updated user. Admins cannot use it on their own account so that they do not
+// lock themselves out, nor on accounts whose role has permissions they lack.
+func (as *AdminServiceImpl) updateUser(response *models.AuthServiceResponse, admin *models.DBResponse, id string, update func(user *models.DBResponse) error) *models.AuthServiceResponse {
+	oid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return userNotFound(response)
+	}
+
+	if admin != nil && admin.ID == oid {
+		response.Err = errors.New("you cannot change your own account")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	target, err := as.AuthRepository.FindUserById(as.ctx, oid)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return userNotFound(response)
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if admin != nil && !utils.LoadRolePermissions().Covers(admin.Role, target.Role) {
+		response.Err = errors.New("you cannot change an account with more permissions than your own")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusForbidden
+		return response
+	}
+
+	if err := update(target); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return userNotFound(response)
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	user, err := as.AuthRepository.FindUserById(as.ctx, oid)
+
+	if err == nil {
+		response.Data = models.FilteredResponse(user)
+	}
+
+	return response
+}
+
+func (as *AdminServiceImpl) revokeUserSessions(userId primitive.ObjectID) error {
+	if err := as.SessionRepository.RevokeUserSessions(as.ctx, userId); err != nil {
+		return err
+	}
+
+	return as.RefreshTokenRepository.RevokeUserRefreshTokens(as.ctx, userId)
+}
+
+func userNotFound(response *models.AuthServiceResponse) *models.AuthServiceResponse {
+	response.Err = errors.New("user not found")
+	response.Message = response.Err.Error()
+	response.Status = "fail"
+	response.StatusCode = http.StatusNotFound
+	return response
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordAudit stores the outcome of response as an audit event. user may be
+// nil when the request could not be tied to an account. Auditing is best
+// effort, a failure is logged and does not fail the request.
+func recordAudit(ctx context.Context, repo models.AuditRepository, eventType string, response *models.AuthServiceResponse, user *models.DBResponse, email string, client models.ClientInfo) {
+	event := &models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Type:      eventType,
+		Outcome:   models.AuditSuccess,
+		Email:     strings.ToLower(email),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		CreatedAt: time.Now(),
+	}
+
+	if user != nil {
+		event.ActorID = user.ID
+		if user.Email != "" {
+			event.Email = user.Email
+		}
+	}
+
+	if response.Status != "success" {
+		event.Outcome = models.AuditFailure
+		event.Reason = response.Message
+	}
+
+	if err := repo.CreateAuditEvent(ctx, event); err != nil {
+		log.Println("could not record audit event", err)
+	}
+}
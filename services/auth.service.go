@@ -4,6 +4,12 @@ import "github.com/tonybobo/auth-template/models"
 
 type AuthService interface {
 	Test() *models.AuthServiceResponse
-	SignUpUser(user *models.SignUpInput) *models.AuthServiceResponse
-	SignInUser(user *models.SignInInput) *models.AuthServiceResponse
+	SignUpUser(user *models.SignUpInput, client models.ClientInfo) *models.AuthServiceResponse
+	ResendVerification(email string, client models.ClientInfo) *models.AuthServiceResponse
+	SignInUser(user *models.SignInInput, client models.ClientInfo) *models.AuthServiceResponse
+	VerifyMFA(challenge *models.MFAChallengeInput, client models.ClientInfo) *models.AuthServiceResponse
+	RequestMagicLink(email string) *models.AuthServiceResponse
+	SignInWithMagicLink(token string, client models.ClientInfo) *models.AuthServiceResponse
+	RequestEmailOTP(email string) *models.AuthServiceResponse
+	SignInWithEmailOTP(input *models.EmailOTPInput, client models.ClientInfo) *models.AuthServiceResponse
 }
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
@@ -11,18 +12,22 @@ import (
 
 	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/repository"
 	"github.com/tonybobo/auth-template/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthServiceImpl struct {
-	AuthRepository models.AuthRepository
-	ctx            context.Context
-	temp           *template.Template
+	AuthRepository         models.AuthRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	SessionRepository      models.SessionRepository
+	AuditRepository        models.AuditRepository
+	ctx                    context.Context
+	temp                   *template.Template
 }
 
-func NewAuthService(AuthRepository models.AuthRepository, ctx context.Context, temp *template.Template) AuthService {
-	return &AuthServiceImpl{AuthRepository, ctx, temp}
+func NewAuthService(AuthRepository models.AuthRepository, RefreshTokenRepository models.RefreshTokenRepository, SessionRepository models.SessionRepository, AuditRepository models.AuditRepository, ctx context.Context, temp *template.Template) AuthService {
+	return &AuthServiceImpl{AuthRepository, RefreshTokenRepository, SessionRepository, AuditRepository, ctx, temp}
 }
 
 func (uc *AuthServiceImpl) Test() *models.AuthServiceResponse {
@@ -32,13 +37,18 @@ func (uc *AuthServiceImpl) Test() *models.AuthServiceResponse {
 	}
 }
 
-func (uc *AuthServiceImpl) SignInUser(credential *models.SignInInput) *models.AuthServiceResponse {
+func (uc *AuthServiceImpl) SignInUser(credential *models.SignInInput, client models.ClientInfo) *models.AuthServiceResponse {
 
 	result := &models.AuthServiceResponse{
 		Status:     "success",
 		StatusCode: http.StatusOK,
 	}
 
+	var user *models.DBResponse
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, signInEvent(models.AuditLogin, result), result, user, credential.Email, client)
+	}()
+
 	user, err := uc.AuthRepository.FindUserByEmail(uc.ctx, credential.Email)
 
 	if err != nil {
@@ -64,17 +74,78 @@ func (uc *AuthServiceImpl) SignInUser(credential *models.SignInInput) *models.Au
 		return result
 	}
 
-	if err := utils.VerifyPassword(user.Password, credential.Password); err != nil {
+	ok := checkPassword(uc.ctx, uc.AuthRepository, uc.temp, result, user, credential.Password, func(err error) {
 		result.Status = "fail"
 		result.StatusCode = http.StatusUnauthorized
 		result.Message = "Invalid Email or Password"
 		result.Err = err
+	})
+	if !ok {
 		return result
 	}
 
-	config, _ := config.LoadConfig(".")
+	uc.upgradePasswordHash(user, credential.Password)
+
+	return uc.completeSignIn(result, user, client)
+}
+
+// upgradePasswordHash re-hashes the password the user signed in with when
+// the stored hash uses another algorithm, weaker parameters or another pepper
+// than the current ones. A failure is only logged, the stored hash still works.
+func (uc *AuthServiceImpl) upgradePasswordHash(user *models.DBResponse, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Println("could not rehash password", err)
+		return
+	}
+
+	if err := uc.AuthRepository.UpdatePasswordHash(uc.ctx, user.ID, user.Password, hashedPassword); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("could not rehash password", err)
+		}
+		return
+	}
+
+	user.Password = hashedPassword
+}
+
+// completeSignIn finishes a login once the first factor has been checked.
+// Users with two factor authentication get an MFA challenge, everyone else
+// gets a new session.
+func (uc *AuthServiceImpl) completeSignIn(result *models.AuthServiceResponse, user *models.DBResponse, client models.ClientInfo) *models.AuthServiceResponse {
+	if user.Disabled {
+		return accountDisabled(result)
+	}
+
+	if user.TwoFactorEnabled {
+		mfaToken, err := uc.AuthRepository.CreateMFAChallenge(uc.ctx, user.ID, time.Now().Add(mfaChallengeExpiresIn()))
+
+		if err != nil {
+			result.Status = "fail"
+			result.StatusCode = http.StatusBadGateway
+			result.Message = err.Error()
+			result.Err = err
+			return result
+		}
 
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+		result.MFAToken = mfaToken
+		result.Message = "Two factor authentication required"
+		return result
+	}
+
+	if err := cancelAccountDeletion(uc.ctx, uc.AuthRepository, user); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	access_token, refresh_token, err := startSession(uc.ctx, uc.SessionRepository, uc.RefreshTokenRepository, user, client)
 
 	if err != nil {
 		result.Status = "fail"
@@ -85,29 +156,303 @@ func (uc *AuthServiceImpl) SignInUser(credential *models.SignInInput) *models.Au
 	}
 
 	result.AccessToken = access_token
+	result.RefreshAccessToken = refresh_token
+
+	return result
+}
+
+// signInEvent is the audit event of a first factor login. A login that only
+// got an MFA challenge is not signed in yet, it is recorded as a login once
+// the challenge is answered.
+func signInEvent(eventType string, result *models.AuthServiceResponse) string {
+	if result.MFAToken != "" {
+		return models.AuditLoginMFAChallenge
+	}
+
+	return eventType
+}
+
+func accountDisabled(result *models.AuthServiceResponse) *models.AuthServiceResponse {
+	result.Err = errors.New("your account has been disabled")
+	result.Status = "fail"
+	result.StatusCode = http.StatusForbidden
+	result.Message = result.Err.Error()
+	return result
+}
+
+func (uc *AuthServiceImpl) RequestMagicLink(email string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Message:    "You will receive a sign in link if user with that email exist",
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	user, token, err := uc.AuthRepository.CreateMagicLinkToken(uc.ctx, email)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return response
+		}
+		response.StatusCode = http.StatusBadGateway
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	// Unverified accounts get the same answer so the response does not tell
+	// them apart, they have to verify their email before they can sign in.
+	if !user.Verified {
+		return response
+	}
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	emailData := utils.EmailData{
+		URL:       "http://localhost:" + config.Port + "/api/auth/magic-link/" + token,
+		FirstName: firstName,
+		Subject:   "Your sign in link, valid for 15 minutes",
+	}
+
+	if err := utils.SendEmail(user, &emailData, uc.temp, "magicLink.html"); err != nil {
+		log.Println("could not send magic link", err)
+	}
+
+	return response
+}
+
+// ResendVerification sends a new verification link to an unverified account.
+// Unknown and already verified addresses get the same answer.
+func (uc *AuthServiceImpl) ResendVerification(email string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Message:    "You will receive a new verification email if an unverified user with that email exist",
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	user, code, err := uc.AuthRepository.ResendVerificationCode(uc.ctx, email)
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, models.AuditResendVerify, response, user, email, client)
+	}()
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return response
+		}
+		response.StatusCode = http.StatusBadGateway
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	emailData := utils.EmailData{
+		URL:       "http://localhost:" + config.Port + "/api/auth/verifyemail/" + code,
+		FirstName: firstName,
+		Subject:   "Please Verify",
+	}
+
+	if err := utils.SendEmail(user, &emailData, uc.temp, "verification.html"); err != nil {
+		log.Println("could not send verification email", err)
+	}
+
+	return response
+}
 
-	refresh_token, err := utils.CreateToken(config.RefreshTokenExpiresIn, user.ID, config.RefreshTokenPrivateKey)
+func (uc *AuthServiceImpl) SignInWithMagicLink(token string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	result := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	var user *models.DBResponse
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, signInEvent(models.AuditLoginMagicLink, result), result, user, "", client)
+	}()
+
+	user, err := uc.AuthRepository.ConsumeMagicLinkToken(uc.ctx, token)
 
 	if err != nil {
+		if err.Error() == "invalid or expired token" {
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = "Invalid or expired sign in link"
+			result.Err = err
+			return result
+		}
 		result.Status = "fail"
-		result.StatusCode = http.StatusBadRequest
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if !user.Verified {
+		result.Err = errors.New("you have not verify the account , please verify your email to login ")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	return uc.completeSignIn(result, user, client)
+}
+
+func (uc *AuthServiceImpl) VerifyMFA(challenge *models.MFAChallengeInput, client models.ClientInfo) *models.AuthServiceResponse {
+
+	result := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	var user *models.DBResponse
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, models.AuditLoginMFA, result, user, "", client)
+	}()
+
+	user, err := uc.AuthRepository.FindUserByMFAChallenge(uc.ctx, challenge.MFAToken)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = "Invalid or expired MFA token, please login again"
+			result.Err = err
+			return result
+		}
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if err := uc.AuthRepository.IncrementMFAChallengeAttempts(uc.ctx, user.ID, maxMFAChallengeAttempts); err != nil {
+		if errors.Is(err, repository.ErrTooManyAttempts) {
+			err = uc.AuthRepository.ClearMFAChallenge(uc.ctx, user.ID)
+		}
+
+		if err != nil {
+			result.Status = "fail"
+			result.StatusCode = http.StatusBadGateway
+			result.Message = err.Error()
+			result.Err = err
+			return result
+		}
+
+		result.Err = errors.New("invalid or expired MFA token, please login again")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = "Invalid or expired MFA token, please login again"
+		return result
+	}
+
+	var valid bool
+	var usedRecoveryCode string
+
+	if challenge.RecoveryCode != "" {
+		usedRecoveryCode, valid = matchRecoveryCode(user, challenge.RecoveryCode)
+	} else {
+		valid, err = verifyTwoFactorCode(uc.ctx, uc.AuthRepository, user, challenge.Code)
+
+		if err != nil {
+			result.Status = "fail"
+			result.StatusCode = http.StatusBadRequest
+			result.Message = err.Error()
+			result.Err = err
+			return result
+		}
+	}
+
+	if valid && usedRecoveryCode != "" {
+		if err := uc.AuthRepository.UseRecoveryCode(uc.ctx, user.ID, usedRecoveryCode); err != nil {
+			if !errors.Is(err, repository.ErrRecoveryCodeUsed) {
+				result.Status = "fail"
+				result.StatusCode = http.StatusBadGateway
+				result.Message = err.Error()
+				result.Err = err
+				return result
+			}
+			valid = false
+		}
+	}
+
+	if !valid {
+		result.Err = errors.New("invalid two factor code")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	if err := uc.AuthRepository.ClearMFAChallenge(uc.ctx, user.ID); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
 		result.Err = err
+		return result
+	}
+
+	if user.Disabled {
+		return accountDisabled(result)
+	}
+
+	if usedRecoveryCode != "" {
+		message := fmt.Sprintf("A recovery code was used to sign in to your account. You have %d recovery codes left.", len(user.RecoveryCodes)-1)
+		sendSecurityAlert(user, uc.temp, "A recovery code was used", message)
+	}
+
+	if err := cancelAccountDeletion(uc.ctx, uc.AuthRepository, user); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
 		result.Message = err.Error()
+		result.Err = err
 		return result
 	}
 
+	access_token, refresh_token, err := startSession(uc.ctx, uc.SessionRepository, uc.RefreshTokenRepository, user, client)
+
+	if err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	result.AccessToken = access_token
 	result.RefreshAccessToken = refresh_token
 
 	return result
 }
 
-func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) *models.AuthServiceResponse {
+func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput, client models.ClientInfo) *models.AuthServiceResponse {
 
 	result := &models.AuthServiceResponse{
 		Status:     "success",
 		StatusCode: http.StatusOK,
 	}
 
+	var newUser *models.DBResponse
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, models.AuditRegister, result, newUser, user.Email, client)
+	}()
+
 	if user.Password != user.PasswordConfirm {
 		result.Err = errors.New("password not match")
 		result.Message = "password not match"
@@ -116,14 +461,26 @@ func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) *models.AuthServ
 		return result
 	}
 
+	if !validatePassword(result, user.Password, user.Email, user.Name) {
+		return result
+	}
+
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = user.CreatedAt
 	user.Email = strings.ToLower(user.Email)
 	user.PasswordConfirm = ""
 	user.Verified = false
-	user.Role = "user"
+	user.Role = models.RoleUser
+
+	hashedPassword, err := utils.HashPassword(user.Password)
+	if err != nil {
+		result.Err = err
+		result.Status = "fail"
+		result.Message = err.Error()
+		result.StatusCode = http.StatusInternalServerError
+		return result
+	}
 
-	hashedPassword, _ := utils.HashPassword(user.Password)
 	user.Password = hashedPassword
 	newUser, code, err := uc.AuthRepository.SignUpUser(uc.ctx, user)
 	if err != nil {
@@ -173,3 +530,150 @@ func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) *models.AuthServ
 
 	return result
 }
+
+func (uc *AuthServiceImpl) RequestEmailOTP(email string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Message:    "You will receive a sign in code if user with that email exist",
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	user, err := uc.AuthRepository.FindUserByEmail(uc.ctx, email)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return response
+		}
+		response.StatusCode = http.StatusBadGateway
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	if !user.Verified {
+		return response
+	}
+
+	code, err := utils.GenerateEmailOTP(emailOTPDigits)
+
+	if err != nil {
+		response.StatusCode = http.StatusInternalServerError
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	hashedCode, err := utils.HashPassword(code)
+
+	if err != nil {
+		response.StatusCode = http.StatusInternalServerError
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	if err := uc.AuthRepository.SetEmailOTP(uc.ctx, user.ID, hashedCode, time.Now().Add(emailOTPExpiresIn)); err != nil {
+		response.StatusCode = http.StatusBadGateway
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	emailData := utils.EmailData{
+		Code:      code,
+		FirstName: firstName,
+		Subject:   "Your sign in code, valid for 10 minutes",
+	}
+
+	if err := utils.SendEmail(user, &emailData, uc.temp, "emailOTP.html"); err != nil {
+		log.Println("could not send sign in code", err)
+	}
+
+	return response
+}
+
+func (uc *AuthServiceImpl) SignInWithEmailOTP(input *models.EmailOTPInput, client models.ClientInfo) *models.AuthServiceResponse {
+
+	result := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	var user *models.DBResponse
+	defer func() {
+		recordAudit(uc.ctx, uc.AuditRepository, signInEvent(models.AuditLoginEmailOTP, result), result, user, input.Email, client)
+	}()
+
+	user, err := uc.AuthRepository.FindUserByEmail(uc.ctx, input.Email)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = "Invalid or expired code"
+			result.Err = err
+			return result
+		}
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if user.EmailOTPCode == "" || !user.EmailOTPAt.After(time.Now()) {
+		result.Err = errors.New("invalid or expired code")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = "Invalid or expired code"
+		return result
+	}
+
+	if err := uc.AuthRepository.IncrementEmailOTPAttempts(uc.ctx, user.ID, maxEmailOTPAttempts); err != nil {
+		if errors.Is(err, repository.ErrTooManyAttempts) {
+			err = uc.AuthRepository.ClearEmailOTP(uc.ctx, user.ID)
+		}
+
+		if err != nil {
+			result.Status = "fail"
+			result.StatusCode = http.StatusBadGateway
+			result.Message = err.Error()
+			result.Err = err
+			return result
+		}
+
+		result.Err = errors.New("invalid or expired code")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = "Invalid or expired code"
+		return result
+	}
+
+	if err := utils.VerifyPassword(user.EmailOTPCode, input.Code); err != nil {
+		result.Err = errors.New("invalid or expired code")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = "Invalid or expired code"
+		return result
+	}
+
+	if err := uc.AuthRepository.ClearEmailOTP(uc.ctx, user.ID); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	return uc.completeSignIn(result, user, client)
+}
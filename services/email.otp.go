@@ -0,0 +1,11 @@
+package services
+
+import "time"
+
+const (
+	emailOTPDigits    = 6
+	emailOTPExpiresIn = 10 * time.Minute
+	// maxEmailOTPAttempts is how many codes may be submitted before the code
+	// is discarded and a new one has to be requested.
+	maxEmailOTPAttempts = 5
+)
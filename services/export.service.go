@@ -0,0 +1,9 @@
+package services
+
+import "github.com/tonybobo/auth-template/models"
+
+type ExportService interface {
+	RequestExport(user *models.DBResponse, format string, client models.ClientInfo) *models.AuthServiceResponse
+	BuildExport(user *models.DBResponse, format string) error
+	DownloadExport(token string) *models.AuthServiceResponse
+}
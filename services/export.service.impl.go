@@ -0,0 +1,195 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultDataExportExpiresIn = 24 * time.Hour
+	dataExportFileName         = "data-export.json"
+)
+
+type ExportServiceImpl struct {
+	SessionRepository    models.SessionRepository
+	WebAuthnRepository   models.WebAuthnRepository
+	AuditRepository      models.AuditRepository
+	DataExportRepository models.DataExportRepository
+	ctx                  context.Context
+	temp                 *template.Template
+}
+
+func NewExportService(SessionRepository models.SessionRepository, WebAuthnRepository models.WebAuthnRepository, AuditRepository models.AuditRepository, DataExportRepository models.DataExportRepository, ctx context.Context, temp *template.Template) ExportService {
+	return &ExportServiceImpl{SessionRepository, WebAuthnRepository, AuditRepository, DataExportRepository, ctx, temp}
+}
+
+func dataExportExpiresIn() time.Duration {
+	config, _ := config.LoadConfig(".")
+
+	if config.DataExportExpiresIn <= 0 {
+		return defaultDataExportExpiresIn
+	}
+
+	return config.DataExportExpiresIn
+}
+
+// RequestExport builds the export in the background, the user gets a
+// download link by email once it is ready.
+func (es *ExportServiceImpl) RequestExport(user *models.DBResponse, format string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusAccepted,
+		Message:    "Your data export is being prepared. You will receive an email with a download link once it is ready",
+	}
+
+	defer func() {
+		recordAudit(es.ctx, es.AuditRepository, models.AuditDataExport, response, user, "", client)
+	}()
+
+	if format != models.DataExportFormatJSON && format != models.DataExportFormatZIP {
+		response.Err = errors.New("format must be json or zip")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	go func() {
+		if err := es.BuildExport(user, format); err != nil {
+			log.Println("could not build data export", err)
+		}
+	}()
+
+	return response
+}
+
+// BuildExport collects everything stored about the user, stores it as an
+// archive and emails the download link.
+func (es *ExportServiceImpl) BuildExport(user *models.DBResponse, format string) error {
+	sessions, err := es.SessionRepository.FindAllUserSessions(es.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	events, err := es.AuditRepository.FindUserAuditEvents(es.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	passkeys, err := es.WebAuthnRepository.FindUserWebAuthnCredentials(es.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&models.UserDataExport{
+		ExportedAt:  time.Now(),
+		Profile:     models.FilteredResponse(user),
+		Sessions:    sessions,
+		AuditEvents: events,
+		Passkeys:    passkeys,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == models.DataExportFormatZIP {
+		if data, err = zipDataExport(data); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	export := &models.DataExport{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Format:    format,
+		Data:      data,
+		ExpiresAt: now.Add(dataExportExpiresIn()),
+		CreatedAt: now,
+	}
+
+	token, err := es.DataExportRepository.CreateDataExport(es.ctx, export)
+	if err != nil {
+		return err
+	}
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	emailData := utils.EmailData{
+		URL:       "http://localhost:" + config.Port + "/api/users/exports/" + token,
+		FirstName: firstName,
+		Subject:   "Your data export is ready",
+		Message:   "The link expires on " + export.ExpiresAt.Format(time.RFC1123) + ".",
+	}
+
+	return utils.SendEmail(user, &emailData, es.temp, "dataExport.html")
+}
+
+func zipDataExport(data []byte) ([]byte, error) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+
+	file, err := writer.Create(dataExportFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return archive.Bytes(), nil
+}
+
+func (es *ExportServiceImpl) DownloadExport(token string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	export, err := es.DataExportRepository.FindDataExportByToken(es.ctx, token)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			response.Err = errors.New("invalid or expired link")
+			response.Message = response.Err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusNotFound
+			return response
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = export
+
+	return response
+}
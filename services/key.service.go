@@ -0,0 +1,7 @@
+package services
+
+import "github.com/tonybobo/auth-template/models"
+
+type KeyService interface {
+	JWKS() *models.AuthServiceResponse
+}
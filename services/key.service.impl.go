@@ -0,0 +1,36 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+type KeyServiceImpl struct{}
+
+func NewKeyService() KeyService {
+	return &KeyServiceImpl{}
+}
+
+// JWKS returns the public access token keys, so other services can verify
+// access tokens on their own.
+func (ks *KeyServiceImpl) JWKS() *models.AuthServiceResponse {
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	ring, err := utils.LoadAccessTokenKeyRing()
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	response.Data = ring.JWKS()
+
+	return response
+}
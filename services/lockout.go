@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+const (
+	defaultLoginMaxAttempts        = 5
+	defaultLoginLockoutDuration    = time.Minute
+	defaultLoginLockoutMaxDuration = 24 * time.Hour
+)
+
+func loginMaxAttempts() int {
+	config, _ := config.LoadConfig(".")
+
+	if config.LoginMaxAttempts <= 0 {
+		return defaultLoginMaxAttempts
+	}
+
+	return config.LoginMaxAttempts
+}
+
+// lockoutDuration doubles the lockout for every lockout since the last
+// successful login, up to LOGIN_LOCKOUT_MAX_DURATION. previousLockouts is the
+// number of lockouts before this one.
+func lockoutDuration(previousLockouts int) time.Duration {
+	config, _ := config.LoadConfig(".")
+
+	duration := config.LoginLockoutDuration
+	if duration <= 0 {
+		duration = defaultLoginLockoutDuration
+	}
+
+	maxDuration := config.LoginLockoutMaxDuration
+	if maxDuration <= 0 {
+		maxDuration = defaultLoginLockoutMaxDuration
+	}
+
+	for i := 0; i < previousLockouts && duration < maxDuration; i++ {
+		duration *= 2
+	}
+
+	if duration > maxDuration {
+		return maxDuration
+	}
+
+	return duration
+}
+
+// checkPassword verifies the password of the user for anything that asks for
+// it, so every form counts towards the same lockout as signing in. Locked
+// accounts are refused, a wrong password is counted and passed to
+// wrongPassword, and the right one resets the count. result is filled in and
+// false returned when the password was not accepted.
+func checkPassword(ctx context.Context, authRepository models.AuthRepository, temp *template.Template, result *models.AuthServiceResponse, user *models.DBResponse, password string, wrongPassword func(err error)) bool {
+	if user.LockedUntil.After(time.Now()) {
+		accountLocked(result, user.LockedUntil)
+		return false
+	}
+
+	if passwordErr := utils.VerifyPassword(user.Password, password); passwordErr != nil {
+		recordFailedLogin(ctx, authRepository, temp, result, user, passwordErr, wrongPassword)
+		return false
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+		if err := authRepository.ResetFailedLogins(ctx, user.ID); err != nil {
+			result.Status = "fail"
+			result.StatusCode = http.StatusBadGateway
+			result.Message = err.Error()
+			result.Err = err
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordFailedLogin counts a wrong password and locks the account once too
+// many wrong passwords were tried in a row.
+func recordFailedLogin(ctx context.Context, authRepository models.AuthRepository, temp *template.Template, result *models.AuthServiceResponse, user *models.DBResponse, passwordErr error, wrongPassword func(err error)) {
+	attempts, err := authRepository.RecordFailedLogin(ctx, user.ID)
+
+	if err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return
+	}
+
+	if attempts < loginMaxAttempts() {
+		wrongPassword(passwordErr)
+		return
+	}
+
+	lockedUntil := time.Now().Add(lockoutDuration(user.LockoutCount))
+
+	if err := authRepository.LockUser(ctx, user.ID, lockedUntil); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return
+	}
+
+	message := fmt.Sprintf("Your account was locked after %d failed sign in attempts. You can sign in again after %s.", attempts, lockedUntil.Format(time.RFC1123))
+	sendSecurityAlert(user, temp, "Your account has been locked", message)
+
+	accountLocked(result, lockedUntil)
+}
+
+func accountLocked(result *models.AuthServiceResponse, lockedUntil time.Time) *models.AuthServiceResponse {
+	retryIn := time.Until(lockedUntil).Round(time.Second)
+
+	result.Err = errors.New("account locked")
+	result.Status = "fail"
+	result.StatusCode = http.StatusLocked
+	result.Message = fmt.Sprintf("Too many failed sign in attempts, please try again in %s", retryIn)
+	return result
+}
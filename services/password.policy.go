@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+// validatePassword checks a new password against the password policy. When
+// it is rejected the response lists every broken rule and false is returned.
+func validatePassword(response *models.AuthServiceResponse, password, email, name string) bool {
+	violations, err := utils.LoadPasswordPolicy().Validate(password, email, name)
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return false
+	}
+
+	if len(violations) > 0 {
+		response.Err = errors.New(strings.Join(violations, "; "))
+		response.Message = response.Err.Error()
+		response.Data = violations
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startSession records a new login session for the user on the client's
+// device and issues the first access and refresh token pair for it.
+func startSession(ctx context.Context, sessions models.SessionRepository, refreshTokens models.RefreshTokenRepository, user *models.DBResponse, client models.ClientInfo) (string, string, error) {
+	config, _ := config.LoadConfig(".")
+
+	now := time.Now()
+	session := &models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		Device:     utils.DescribeDevice(client.UserAgent),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		ExpiresAt:  now.Add(config.RefreshTokenExpiresIn),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	if err := sessions.CreateSession(ctx, session); err != nil {
+		return "", "", err
+	}
+
+	return issueTokens(ctx, refreshTokens, user, session.ID)
+}
+
+// issueTokens creates a new access token and refresh token for the session.
+// The access token carries the role of the user and its permissions as the
+// scope. The refresh token is stored with the session as its family so that
+// it can be rotated on refresh and revoked together with the session.
+func issueTokens(ctx context.Context, repo models.RefreshTokenRepository, user *models.DBResponse, sessionId primitive.ObjectID) (string, string, error) {
+	config, _ := config.LoadConfig(".")
+
+	ring, err := utils.LoadAccessTokenKeyRing()
+	if err != nil {
+		return "", "", err
+	}
+
+	accessClaims := utils.NewTokenClaims(config.AccessTokenExpiresIn, user.ID.Hex(), utils.LoadTokenOptions())
+	accessClaims.SessionID = sessionId.Hex()
+	accessClaims.Role = user.Role
+	accessClaims.Scope = strings.Join(utils.LoadRolePermissions()[user.Role], " ")
+
+	accessToken, err := utils.CreateToken(accessClaims, ring)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	stored := &models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Family:    sessionId,
+		ExpiresAt: now.Add(config.RefreshTokenExpiresIn),
+		CreatedAt: now,
+	}
+
+	claims := map[string]interface{}{"jti": stored.ID.Hex()}
+	refreshToken, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, user.ID, claims, config.RefreshTokenPrivateKey)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := repo.CreateRefreshToken(ctx, stored); err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
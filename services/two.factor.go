@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/repository"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+// maxMFAChallengeAttempts is how many codes may be submitted for one MFA
+// challenge before it is discarded and the user has to login again.
+const maxMFAChallengeAttempts = 5
+
+const defaultMFAChallengeExpiresIn = 5 * time.Minute
+
+const recoveryCodeCount = 10
+
+// verifyTwoFactorCode checks code against the user's stored TOTP secret and
+// stores its time step, so the same code is not accepted twice.
+func verifyTwoFactorCode(ctx context.Context, authRepository models.AuthRepository, user *models.DBResponse, code string) (bool, error) {
+	if user.TwoFactorSecret == "" {
+		return false, errors.New("two factor authentication has not been enrolled")
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	secret, err := utils.Decrypt(user.TwoFactorSecret, config.TwoFactorEncryptionKey)
+	if err != nil {
+		return false, err
+	}
+
+	counter, valid := utils.MatchTOTP(secret, code, time.Now(), user.TwoFactorLastCounter)
+	if !valid {
+		return false, nil
+	}
+
+	if err := authRepository.UseTOTPCounter(ctx, user.ID, counter); err != nil {
+		if errors.Is(err, repository.ErrTOTPCodeUsed) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func mfaChallengeExpiresIn() time.Duration {
+	config, _ := config.LoadConfig(".")
+
+	if config.MFAChallengeExpiresIn <= 0 {
+		return defaultMFAChallengeExpiresIn
+	}
+
+	return config.MFAChallengeExpiresIn
+}
+
+// newRecoveryCodes generates a fresh set of recovery codes and returns them
+// together with the hashes that are stored on the user.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashedCodes := make([]string, len(codes))
+	for i, code := range codes {
+		hashedCodes[i], err = utils.HashPassword(code)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return codes, hashedCodes, nil
+}
+
+// matchRecoveryCode returns the stored hash of the recovery code, if any.
+func matchRecoveryCode(user *models.DBResponse, code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	for _, hashedCode := range user.RecoveryCodes {
+		if utils.VerifyPassword(hashedCode, code) == nil {
+			return hashedCode, true
+		}
+	}
+
+	return "", false
+}
+
+// sendSecurityAlert emails the user about a security relevant change on the
+// account. Failing to deliver the alert does not fail the request.
+func sendSecurityAlert(user *models.DBResponse, temp *template.Template, subject, message string) {
+	var firstName = user.Name
+
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	emailData := utils.EmailData{
+		FirstName: firstName,
+		Subject:   subject,
+		Message:   message,
+	}
+
+	if err := utils.SendEmail(user, &emailData, temp, "securityAlert.html"); err != nil {
+		log.Println("could not send security alert", err)
+	}
+}
@@ -2,14 +2,29 @@ package services
 
 import (
 	"github.com/tonybobo/auth-template/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserService interface {
 	FindUserById(id string) (*models.DBResponse, error)
+	FindSessionById(id string) (*models.Session, error)
 
-	UpdateOne(field string, value interface{}) (*models.DBResponse, error)
-	ForgetPassword(email string) *models.AuthServiceResponse
-	RefreshAccessToken(cookie string) *models.AuthServiceResponse
-	ResetPassword(user *models.ResetPasswordInput, resetToken string) *models.AuthServiceResponse
-	VerifyEmail(verificationCode string) *models.AuthServiceResponse
+	UpdateOne(id string, field string, value interface{}) (*models.DBResponse, error)
+	UpdateProfile(user *models.DBResponse, input *models.UpdateProfileInput) *models.AuthServiceResponse
+	ConfirmEmailChange(token string, client models.ClientInfo) *models.AuthServiceResponse
+	ForgetPassword(email string, client models.ClientInfo) *models.AuthServiceResponse
+	RefreshAccessToken(cookie string, client models.ClientInfo) *models.AuthServiceResponse
+	ChangePassword(user *models.DBResponse, currentSessionId primitive.ObjectID, input *models.ChangePasswordInput, client models.ClientInfo) *models.AuthServiceResponse
+	DeleteAccount(user *models.DBResponse, input *models.DeleteAccountInput, client models.ClientInfo) *models.AuthServiceResponse
+	ResetPassword(user *models.ResetPasswordInput, resetToken string, client models.ClientInfo) *models.AuthServiceResponse
+	VerifyEmail(verificationCode string, client models.ClientInfo) *models.AuthServiceResponse
+	Logout(sessionId string) *models.AuthServiceResponse
+	LogoutRefreshToken(cookie string) *models.AuthServiceResponse
+	LogoutEverywhere(userId string) *models.AuthServiceResponse
+	ListSessions(user *models.DBResponse, currentSessionId primitive.ObjectID) *models.AuthServiceResponse
+	RevokeSession(user *models.DBResponse, sessionId string) *models.AuthServiceResponse
+	EnrollTwoFactor(user *models.DBResponse) *models.AuthServiceResponse
+	ConfirmTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse
+	DisableTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse
+	RegenerateRecoveryCodes(user *models.DBResponse, code string) *models.AuthServiceResponse
 }
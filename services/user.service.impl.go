@@ -7,25 +7,30 @@ import (
 	"html/template"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/repository"
 	"github.com/tonybobo/auth-template/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserServiceImpl struct {
-	AuthRepository models.AuthRepository
-	ctx            context.Context
-	temp           *template.Template
+	AuthRepository         models.AuthRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	SessionRepository      models.SessionRepository
+	AuditRepository        models.AuditRepository
+	ctx                    context.Context
+	temp                   *template.Template
 }
 
-func NewUserServiceImpl(AuthRepository models.AuthRepository, ctx context.Context, temp *template.Template) UserService {
-	return &UserServiceImpl{AuthRepository, ctx, temp}
+func NewUserServiceImpl(AuthRepository models.AuthRepository, RefreshTokenRepository models.RefreshTokenRepository, SessionRepository models.SessionRepository, AuditRepository models.AuditRepository, ctx context.Context, temp *template.Template) UserService {
+	return &UserServiceImpl{AuthRepository, RefreshTokenRepository, SessionRepository, AuditRepository, ctx, temp}
 }
 
-func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthServiceResponse {
+func (us *UserServiceImpl) RefreshAccessToken(cookie string, client models.ClientInfo) *models.AuthServiceResponse {
 
 	result := &models.AuthServiceResponse{
 		Status:     "success",
@@ -34,7 +39,7 @@ func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthService
 
 	config, _ := config.LoadConfig(".")
 
-	sub, err := utils.ValidateToken(cookie, config.RefreshTokenPublicKey)
+	claims, err := utils.ParseToken(cookie, config.RefreshTokenPublicKey)
 
 	if err != nil {
 		result.Status = "fail"
@@ -44,7 +49,7 @@ func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthService
 		return result
 	}
 
-	oid, err := primitive.ObjectIDFromHex(fmt.Sprint(sub))
+	oid, err := primitive.ObjectIDFromHex(fmt.Sprint(claims["sub"]))
 
 	if err != nil {
 		result.Err = err
@@ -54,6 +59,68 @@ func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthService
 		return result
 	}
 
+	jti, err := primitive.ObjectIDFromHex(fmt.Sprint(claims["jti"]))
+
+	if err != nil {
+		result.Err = err
+		result.Message = "Invalid Token"
+		result.Status = "fail"
+		result.StatusCode = http.StatusForbidden
+		return result
+	}
+
+	stored, err := us.RefreshTokenRepository.FindRefreshTokenById(us.ctx, jti)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			result.Err = err
+			result.Message = "Invalid Token"
+			result.Status = "fail"
+			result.StatusCode = http.StatusForbidden
+			return result
+		}
+		result.Err = err
+		result.Message = err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		return result
+	}
+
+	if stored.UserID != oid || stored.Revoked {
+		result.Err = errors.New("refresh token has been revoked")
+		result.Message = result.Err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusForbidden
+		return result
+	}
+
+	// A refresh token that was already exchanged is being replayed, so the
+	// whole family is treated as compromised and revoked.
+	if stored.Used {
+		return us.revokeRefreshTokenFamily(result, stored.Family)
+	}
+
+	session, err := us.SessionRepository.FindSessionById(us.ctx, stored.Family)
+
+	if err != nil || session.Revoked {
+		result.Err = errors.New("session has been revoked")
+		result.Message = result.Err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusForbidden
+		return result
+	}
+
+	if err := us.RefreshTokenRepository.MarkRefreshTokenUsed(us.ctx, stored.ID); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenUsed) {
+			return us.revokeRefreshTokenFamily(result, stored.Family)
+		}
+		result.Err = err
+		result.Message = err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		return result
+	}
+
 	user, err := us.AuthRepository.FindUserById(us.ctx, oid)
 
 	if err != nil {
@@ -64,7 +131,11 @@ func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthService
 		return result
 	}
 
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+	if user.Disabled {
+		return accountDisabled(result)
+	}
+
+	access_token, refresh_token, err := issueTokens(us.ctx, us.RefreshTokenRepository, user, stored.Family)
 
 	if err != nil {
 		result.Err = err
@@ -74,49 +145,115 @@ func (us *UserServiceImpl) RefreshAccessToken(cookie string) *models.AuthService
 		return result
 	}
 
+	if err := us.SessionRepository.TouchSession(us.ctx, session.ID, time.Now().Add(config.RefreshTokenExpiresIn), client); err != nil {
+		result.Err = err
+		result.Message = err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		return result
+	}
+
 	result.AccessToken = access_token
+	result.RefreshAccessToken = refresh_token
 	return result
 
 }
 
-func (us *UserServiceImpl) FindUserById(id string) (*models.DBResponse, error) {
+func (us *UserServiceImpl) revokeRefreshTokenFamily(result *models.AuthServiceResponse, family primitive.ObjectID) *models.AuthServiceResponse {
+	if err := us.SessionRepository.RevokeSession(us.ctx, family); err != nil {
+		result.Err = err
+		result.Message = err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		return result
+	}
+
+	if err := us.RefreshTokenRepository.RevokeRefreshTokenFamily(us.ctx, family); err != nil {
+		result.Err = err
+		result.Message = err.Error()
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		return result
+	}
+
+	result.Err = errors.New("refresh token reuse detected")
+	result.Message = result.Err.Error()
+	result.Status = "fail"
+	result.StatusCode = http.StatusForbidden
+	return result
+}
+
+func (us *UserServiceImpl) FindSessionById(id string) (*models.Session, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid User ID")
+		return nil, errors.New("invalid Session ID")
 	}
 
-	user, err := us.AuthRepository.FindUserById(us.ctx, oid)
+	session, err := us.SessionRepository.FindSessionById(us.ctx, oid)
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
-
+	return session, nil
 }
 
-func (us *UserServiceImpl) UpdateOne(field string, value interface{}) (*models.DBResponse, error) {
+func (us *UserServiceImpl) Logout(sessionId string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
 
-	_, err := us.AuthRepository.UpdateOne(us.ctx, field, value)
+	oid, err := primitive.ObjectIDFromHex(sessionId)
 
 	if err != nil {
-		return &models.DBResponse{}, err
+		response.Err = errors.New("invalid Session ID")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
 	}
 
-	return &models.DBResponse{}, nil
+	return us.endSession(response, oid)
 }
 
-func (us *UserServiceImpl) VerifyEmail(verificationCode string) *models.AuthServiceResponse {
+// LogoutRefreshToken ends the session the refresh token belongs to. Unlike
+// Logout it does not need a valid access token, so a user whose access token
+// has expired can still revoke the refresh tokens of the session.
+func (us *UserServiceImpl) LogoutRefreshToken(cookie string) *models.AuthServiceResponse {
 
 	response := &models.AuthServiceResponse{
 		Status:     "success",
 		StatusCode: http.StatusOK,
-		Message:    "Successfully Verified",
 	}
-	err := us.AuthRepository.VerifyEmail(us.ctx, verificationCode)
+
+	config, _ := config.LoadConfig(".")
+
+	claims, err := utils.ParseToken(cookie, config.RefreshTokenPublicKey)
+
+	if err != nil {
+		response.Err = err
+		response.Message = "Invalid Token"
+		response.Status = "fail"
+		response.StatusCode = http.StatusForbidden
+		return response
+	}
+
+	jti, err := primitive.ObjectIDFromHex(fmt.Sprint(claims["jti"]))
 
 	if err != nil {
-		if err.Error() == "invalid email" {
+		response.Err = err
+		response.Message = "Invalid Token"
+		response.Status = "fail"
+		response.StatusCode = http.StatusForbidden
+		return response
+	}
+
+	stored, err := us.RefreshTokenRepository.FindRefreshTokenById(us.ctx, jti)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
 			response.Err = err
-			response.Message = err.Error()
+			response.Message = "Invalid Token"
 			response.Status = "fail"
 			response.StatusCode = http.StatusForbidden
 			return response
@@ -128,73 +265,255 @@ func (us *UserServiceImpl) VerifyEmail(verificationCode string) *models.AuthServ
 		return response
 	}
 
+	if stored.UserID.Hex() != fmt.Sprint(claims["sub"]) {
+		response.Err = errors.New("invalid token")
+		response.Message = "Invalid Token"
+		response.Status = "fail"
+		response.StatusCode = http.StatusForbidden
+		return response
+	}
+
+	return us.endSession(response, stored.Family)
+}
+
+// endSession revokes the session together with its refresh tokens.
+func (us *UserServiceImpl) endSession(response *models.AuthServiceResponse, sessionId primitive.ObjectID) *models.AuthServiceResponse {
+	if err := us.SessionRepository.RevokeSession(us.ctx, sessionId); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.RefreshTokenRepository.RevokeRefreshTokenFamily(us.ctx, sessionId); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
 	return response
 }
 
-func (us *UserServiceImpl) ResetPassword(user *models.ResetPasswordInput, resetToken string) *models.AuthServiceResponse {
+func (us *UserServiceImpl) ListSessions(user *models.DBResponse, currentSessionId primitive.ObjectID) *models.AuthServiceResponse {
 
 	response := &models.AuthServiceResponse{
 		Status:     "success",
 		StatusCode: http.StatusOK,
-		Message:    "Password updated successfully. Please Login with new password",
 	}
 
-	if user.Password != user.PasswordConfirm {
-		response.Status = "fail"
-		response.StatusCode = http.StatusBadRequest
-		response.Message = "Password does not match"
+	sessions, err := us.SessionRepository.FindUserSessions(us.ctx, user.ID)
 
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
 		return response
 	}
 
-	err := us.AuthRepository.ClearResetPasswordToken(us.ctx, resetToken, user.Password)
+	data := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		data[i] = models.SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.ID == currentSessionId,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+		}
+	}
+
+	response.Data = data
+
+	return response
+}
+
+// RevokeSession signs the user out of one of their sessions. Sessions of
+// other users are reported as not found.
+func (us *UserServiceImpl) RevokeSession(user *models.DBResponse, sessionId string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Session has been revoked",
+	}
+
+	oid, err := primitive.ObjectIDFromHex(sessionId)
 
 	if err != nil {
-		if err.Error() == "invalid or expired token" {
-			response.Status = "fail"
-			response.StatusCode = http.StatusForbidden
-			response.Message = err.Error()
-			response.Err = err
-			return response
+		return sessionNotFound(response)
+	}
+
+	session, err := us.SessionRepository.FindSessionById(us.ctx, oid)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return sessionNotFound(response)
 		}
+		response.Err = err
+		response.Message = err.Error()
 		response.Status = "fail"
 		response.StatusCode = http.StatusBadGateway
-		response.Message = err.Error()
+		return response
+	}
+
+	if session.UserID != user.ID || session.Revoked {
+		return sessionNotFound(response)
+	}
+
+	return us.endSession(response, oid)
+}
+
+func sessionNotFound(response *models.AuthServiceResponse) *models.AuthServiceResponse {
+	response.Err = errors.New("session not found")
+	response.Message = response.Err.Error()
+	response.Status = "fail"
+	response.StatusCode = http.StatusNotFound
+	return response
+}
+
+func (us *UserServiceImpl) LogoutEverywhere(userId string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	oid, err := primitive.ObjectIDFromHex(userId)
+
+	if err != nil {
+		response.Err = errors.New("invalid User ID")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if err := us.SessionRepository.RevokeUserSessions(us.ctx, oid); err != nil {
 		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
 
+	if err := us.RefreshTokenRepository.RevokeUserRefreshTokens(us.ctx, oid); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
 		return response
 	}
 
 	return response
 }
 
-func (us *UserServiceImpl) ForgetPassword(email string) *models.AuthServiceResponse {
+func (us *UserServiceImpl) FindUserById(id string) (*models.DBResponse, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid User ID")
+	}
+
+	user, err := us.AuthRepository.FindUserById(us.ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+
+}
+
+func (us *UserServiceImpl) UpdateOne(id string, field string, value interface{}) (*models.DBResponse, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid User ID")
+	}
+
+	user, err := us.AuthRepository.UpdateOne(us.ctx, oid, field, value)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile updates the fields set in input. A new email is only stored
+// as pending, it replaces the current one once the link sent to it is opened.
+func (us *UserServiceImpl) UpdateProfile(user *models.DBResponse, input *models.UpdateProfileInput) *models.AuthServiceResponse {
 
 	response := &models.AuthServiceResponse{
-		Message:    "You will receive a reset email if user with that email exist",
 		Status:     "success",
 		StatusCode: http.StatusOK,
+		Message:    "Profile updated",
 	}
 
-	user, resetToken, err := us.AuthRepository.ForgetPassword(us.ctx, email)
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
 
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			response.StatusCode = http.StatusOK
+		if name == "" {
+			response.Err = errors.New("name cannot be empty")
+			response.Message = response.Err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusBadRequest
 			return response
 		}
-		response.StatusCode = http.StatusBadGateway
-		response.Status = "fail"
-		response.Message = err.Error()
+
+		if name != user.Name {
+			updated, err := us.AuthRepository.UpdateOne(us.ctx, user.ID, "name", name)
+
+			if err != nil {
+				response.Err = err
+				response.Message = err.Error()
+				response.Status = "fail"
+				response.StatusCode = http.StatusBadGateway
+				return response
+			}
+
+			user = updated
+		}
+	}
+
+	if input.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*input.Email))
+
+		if email != user.Email {
+			if result := us.requestEmailChange(response, user, email); result.Status != "success" {
+				return result
+			}
+			user.PendingEmail = email
+			response.Message = "Profile updated. Please confirm your new email with the link we sent to it"
+		}
+	}
+
+	response.User = user
+
+	return response
+}
+
+func (us *UserServiceImpl) requestEmailChange(response *models.AuthServiceResponse, user *models.DBResponse, email string) *models.AuthServiceResponse {
+
+	if _, err := us.AuthRepository.FindUserByEmail(us.ctx, email); err != mongo.ErrNoDocuments {
+		if err == nil {
+			err = errors.New("user with that email already exist")
+			response.StatusCode = http.StatusConflict
+		} else {
+			response.StatusCode = http.StatusBadGateway
+		}
 		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
 		return response
 	}
 
-	if !user.Verified {
-		response.StatusCode = http.StatusUnauthorized
+	token, err := us.AuthRepository.RequestEmailChange(us.ctx, user.ID, email)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
 		response.Status = "fail"
-		response.Err = errors.New("account has not been verified. please verify your account with the email sent")
-		response.Message = response.Err.Error()
+		response.StatusCode = http.StatusBadGateway
 		return response
 	}
 
@@ -206,21 +525,562 @@ func (us *UserServiceImpl) ForgetPassword(email string) *models.AuthServiceRespo
 	config, _ := config.LoadConfig(".")
 
 	emailData := utils.EmailData{
-		URL:       "http://localhost:" + config.Port + "/api/auth/resetpassword/" + resetToken,
+		URL:       "http://localhost:" + config.Port + "/api/auth/confirm-email/" + token,
 		FirstName: firstName,
-		Subject:   "Please Reset the password within 15 minutes",
+		Subject:   "Please confirm your new email within 24 hours",
 	}
 
-	err = utils.SendEmail(user, &emailData, us.temp, "resetPassword.html")
+	recipient := *user
+	recipient.Email = email
 
-	if err != nil {
-		response.StatusCode = http.StatusBadGateway
+	if err := utils.SendEmail(&recipient, &emailData, us.temp, "confirmEmail.html"); err != nil {
 		response.Err = err
-		response.Status = "fail"
 		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
 		return response
 	}
 
+	sendSecurityAlert(user, us.temp, "Your email is being changed", "A request was made to change the email of your account to "+email+". The change only happens once the new address is confirmed. If you did not do this, change your password right away.")
+
+	return response
+}
+
+// ConfirmEmailChange switches the email of the account to the pending email
+// the token was sent to.
+func (us *UserServiceImpl) ConfirmEmailChange(token string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Your email has been changed",
+	}
+
+	user, err := us.AuthRepository.ConfirmEmailChange(us.ctx, token)
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditChangeEmail, response, user, "", client)
+	}()
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		switch err.Error() {
+		case "invalid or expired token":
+			response.StatusCode = http.StatusForbidden
+		case "user with that email already exist":
+			response.StatusCode = http.StatusConflict
+		default:
+			response.StatusCode = http.StatusBadGateway
+		}
+		return response
+	}
+
+	return response
+}
+
+func (us *UserServiceImpl) VerifyEmail(verificationCode string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Successfully Verified",
+	}
+
+	user, err := us.AuthRepository.VerifyEmail(us.ctx, verificationCode)
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditVerifyEmail, response, user, "", client)
+	}()
+
+	if err != nil {
+		if err.Error() == "invalid email" {
+			response.Err = err
+			response.Message = err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusForbidden
+			return response
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	return response
+}
+
+func (us *UserServiceImpl) ResetPassword(user *models.ResetPasswordInput, resetToken string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Password updated successfully. Please Login with new password",
+	}
+
+	var dbUser *models.DBResponse
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditResetPassword, response, dbUser, "", client)
+	}()
+
+	if user.Password != user.PasswordConfirm {
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		response.Message = "Password does not match"
+
+		return response
+	}
+
+	// The user is looked up before the token is used, so the new password can
+	// be checked against their name and email.
+	dbUser, err := us.AuthRepository.FindUserByResetToken(us.ctx, resetToken)
+	if err == nil {
+		if !validatePassword(response, user.Password, dbUser.Email, dbUser.Name) {
+			return response
+		}
+
+		// hashErr keeps err, which is checked below, from being shadowed.
+		hashedPassword, hashErr := utils.HashPassword(user.Password)
+		if hashErr != nil {
+			response.Err = hashErr
+			response.Message = hashErr.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusInternalServerError
+			return response
+		}
+
+		dbUser, err = us.AuthRepository.ClearResetPasswordToken(us.ctx, resetToken, hashedPassword)
+	}
+
+	if err != nil {
+		if err.Error() == "invalid or expired token" {
+			response.Status = "fail"
+			response.StatusCode = http.StatusForbidden
+			response.Message = err.Error()
+			response.Err = err
+			return response
+		}
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		response.Message = err.Error()
+		response.Err = err
+
+		return response
+	}
+
+	return response
+}
+
+// ChangePassword replaces the password of a signed in user. Every session but
+// the current one is signed out, and the user is told about the change.
+func (us *UserServiceImpl) ChangePassword(user *models.DBResponse, currentSessionId primitive.ObjectID, input *models.ChangePasswordInput, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Password updated successfully. Other sessions have been signed out",
+	}
+
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditChangePassword, response, user, "", client)
+	}()
+
+	ok := checkPassword(us.ctx, us.AuthRepository, us.temp, response, user, input.CurrentPassword, func(error) {
+		response.Err = errors.New("current password is incorrect")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+	})
+	if !ok {
+		return response
+	}
+
+	if input.Password != input.PasswordConfirm {
+		response.Err = errors.New("password does not match")
+		response.Message = "Password does not match"
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if !validatePassword(response, input.Password, user.Email, user.Name) {
+		return response
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	if err := us.AuthRepository.UpdatePassword(us.ctx, user.ID, hashedPassword); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.SessionRepository.RevokeOtherSessions(us.ctx, user.ID, currentSessionId); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.RefreshTokenRepository.RevokeOtherRefreshTokens(us.ctx, user.ID, currentSessionId); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	sendSecurityAlert(user, us.temp, "Your password was changed", "The password of your account was changed and every other device was signed out. If you did not do this, reset your password right away.")
+
+	return response
+}
+
+// DeleteAccount schedules the deletion of the account after the grace period
+// and signs the user out everywhere. Signing in again before then cancels it.
+func (us *UserServiceImpl) DeleteAccount(user *models.DBResponse, input *models.DeleteAccountInput, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditDeleteAccount, response, user, "", client)
+	}()
+
+	ok := checkPassword(us.ctx, us.AuthRepository, us.temp, response, user, input.Password, func(error) {
+		response.Err = errors.New("password is incorrect")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+	})
+	if !ok {
+		return response
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGracePeriod())
+
+	if err := us.AuthRepository.ScheduleUserDeletion(us.ctx, user.ID, deleteAt); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.SessionRepository.RevokeUserSessions(us.ctx, user.ID); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.RefreshTokenRepository.RevokeUserRefreshTokens(us.ctx, user.ID); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Message = fmt.Sprintf("Your account will be deleted on %s. Sign in again before then to cancel the deletion", deleteAt.Format(time.RFC1123))
+	sendSecurityAlert(user, us.temp, "Your account will be deleted", response.Message+". If you did not ask for this, sign in and change your password right away.")
+
+	return response
+}
+
+func (us *UserServiceImpl) ForgetPassword(email string, client models.ClientInfo) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Message:    "You will receive a reset email if user with that email exist",
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	user, resetToken, err := us.AuthRepository.ForgetPassword(us.ctx, email)
+	defer func() {
+		recordAudit(us.ctx, us.AuditRepository, models.AuditForgotPassword, response, user, email, client)
+	}()
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			response.StatusCode = http.StatusOK
+			return response
+		}
+		response.StatusCode = http.StatusBadGateway
+		response.Status = "fail"
+		response.Message = err.Error()
+		response.Err = err
+		return response
+	}
+
+	if !user.Verified {
+		response.StatusCode = http.StatusUnauthorized
+		response.Status = "fail"
+		response.Err = errors.New("account has not been verified. please verify your account with the email sent")
+		response.Message = response.Err.Error()
+		return response
+	}
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	emailData := utils.EmailData{
+		URL:       "http://localhost:" + config.Port + "/api/auth/resetpassword/" + resetToken,
+		FirstName: firstName,
+		Subject:   "Please Reset the password within 15 minutes",
+	}
+
+	err = utils.SendEmail(user, &emailData, us.temp, "resetPassword.html")
+
+	if err != nil {
+		response.StatusCode = http.StatusBadGateway
+		response.Err = err
+		response.Status = "fail"
+		response.Message = err.Error()
+		return response
+	}
+
+	return response
+
+}
+
+func (us *UserServiceImpl) EnrollTwoFactor(user *models.DBResponse) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Add the secret to your authenticator app and confirm it with a code",
+	}
+
+	if user.TwoFactorEnabled {
+		response.Err = errors.New("two factor authentication is already enabled")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusConflict
+		return response
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	encryptedSecret, err := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	if err := us.AuthRepository.SetTwoFactorSecret(us.ctx, user.ID, encryptedSecret); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = models.TwoFactorEnrollment{
+		Secret: secret,
+		URL:    utils.TOTPURL(config.TwoFactorIssuer, user.Email, secret),
+	}
+
+	return response
+}
+
+func (us *UserServiceImpl) ConfirmTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Two factor authentication enabled",
+	}
+
+	if user.TwoFactorEnabled {
+		response.Err = errors.New("two factor authentication is already enabled")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusConflict
+		return response
+	}
+
+	valid, err := verifyTwoFactorCode(us.ctx, us.AuthRepository, user, code)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if !valid {
+		response.Err = errors.New("invalid two factor code")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	codes, hashedCodes, err := newRecoveryCodes()
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	if err := us.AuthRepository.SetRecoveryCodes(us.ctx, user.ID, hashedCodes); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if err := us.AuthRepository.EnableTwoFactor(us.ctx, user.ID); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Message = "Two factor authentication enabled. Store the recovery codes somewhere safe, each can be used once"
+	response.Data = models.RecoveryCodesResponse{RecoveryCodes: codes}
+
+	return response
+}
+
+func (us *UserServiceImpl) RegenerateRecoveryCodes(user *models.DBResponse, code string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "New recovery codes generated. Previous recovery codes no longer work",
+	}
+
+	if !user.TwoFactorEnabled {
+		response.Err = errors.New("two factor authentication is not enabled")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	valid, err := verifyTwoFactorCode(us.ctx, us.AuthRepository, user, code)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if !valid {
+		response.Err = errors.New("invalid two factor code")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	codes, hashedCodes, err := newRecoveryCodes()
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusInternalServerError
+		return response
+	}
+
+	if err := us.AuthRepository.SetRecoveryCodes(us.ctx, user.ID, hashedCodes); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	sendSecurityAlert(user, us.temp, "Your recovery codes were regenerated", "New two factor recovery codes were generated for your account and the previous codes have stopped working.")
+
+	response.Data = models.RecoveryCodesResponse{RecoveryCodes: codes}
+
 	return response
+}
+
+func (us *UserServiceImpl) DisableTwoFactor(user *models.DBResponse, code string) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "Two factor authentication disabled",
+	}
+
+	if !user.TwoFactorEnabled {
+		response.Err = errors.New("two factor authentication is not enabled")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	valid, err := verifyTwoFactorCode(us.ctx, us.AuthRepository, user, code)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if !valid {
+		response.Err = errors.New("invalid two factor code")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
 
+	if err := us.AuthRepository.DisableTwoFactor(us.ctx, user.ID); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	return response
 }
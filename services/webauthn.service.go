@@ -0,0 +1,10 @@
+package services
+
+import "github.com/tonybobo/auth-template/models"
+
+type WebAuthnService interface {
+	BeginRegistration(user *models.DBResponse) *models.AuthServiceResponse
+	FinishRegistration(user *models.DBResponse, credential *models.WebAuthnRegistrationInput) *models.AuthServiceResponse
+	BeginLogin(input *models.WebAuthnLoginOptionsInput) *models.AuthServiceResponse
+	FinishLogin(assertion *models.WebAuthnAssertionInput, client models.ClientInfo) *models.AuthServiceResponse
+}
@@ -0,0 +1,555 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	webAuthnTimeout          = 5 * time.Minute
+	webAuthnRegistrationType = "webauthn.create"
+	webAuthnAssertionType    = "webauthn.get"
+	webAuthnPublicKeyType    = "public-key"
+)
+
+type WebAuthnServiceImpl struct {
+	AuthRepository         models.AuthRepository
+	WebAuthnRepository     models.WebAuthnRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	SessionRepository      models.SessionRepository
+	AuditRepository        models.AuditRepository
+	ctx                    context.Context
+}
+
+func NewWebAuthnService(AuthRepository models.AuthRepository, WebAuthnRepository models.WebAuthnRepository, RefreshTokenRepository models.RefreshTokenRepository, SessionRepository models.SessionRepository, AuditRepository models.AuditRepository, ctx context.Context) WebAuthnService {
+	return &WebAuthnServiceImpl{AuthRepository, WebAuthnRepository, RefreshTokenRepository, SessionRepository, AuditRepository, ctx}
+}
+
+func (ws *WebAuthnServiceImpl) BeginRegistration(user *models.DBResponse) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	credentials, err := ws.WebAuthnRepository.FindUserWebAuthnCredentials(ws.ctx, user.ID)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	challenge, err := ws.createChallenge(webAuthnRegistrationType, user.ID)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = models.WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP:        models.WebAuthnRelyingParty{ID: config.WebAuthnRPID, Name: config.WebAuthnRPName},
+		User: models.WebAuthnUserEntity{
+			ID:          webAuthnUserHandle(user.ID),
+			Name:        user.Email,
+			DisplayName: user.Name,
+		},
+		PubKeyCredParams: []models.WebAuthnCredentialParameter{
+			{Type: webAuthnPublicKeyType, Alg: utils.COSEAlgES256},
+			{Type: webAuthnPublicKeyType, Alg: utils.COSEAlgEdDSA},
+			{Type: webAuthnPublicKeyType, Alg: utils.COSEAlgRS256},
+		},
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		ExcludeCredentials: webAuthnDescriptors(credentials),
+		AuthenticatorSelection: models.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+
+	return response
+}
+
+func (ws *WebAuthnServiceImpl) FinishRegistration(user *models.DBResponse, input *models.WebAuthnRegistrationInput) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusCreated,
+		Message:    "Passkey registered",
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	if input.Type != webAuthnPublicKeyType {
+		response.Err = errors.New("invalid credential type")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	clientDataJSON, err := utils.DecodeWebAuthn(input.Response.ClientDataJSON)
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	attestationObject, err := utils.DecodeWebAuthn(input.Response.AttestationObject)
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	challenge, err := utils.VerifyClientData(clientDataJSON, webAuthnRegistrationType, config.WebAuthnOrigin)
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	stored, err := ws.WebAuthnRepository.ConsumeWebAuthnChallenge(ws.ctx, challenge, webAuthnRegistrationType)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			response.Err = errors.New("invalid or expired challenge")
+			response.Message = response.Err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusBadRequest
+			return response
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	if stored.UserID != user.ID {
+		response.Err = errors.New("invalid or expired challenge")
+		response.Message = response.Err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	authData, err := utils.ParseAttestationObject(attestationObject)
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if err := verifyAuthenticatorFlags(authData, config.WebAuthnRPID); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	if _, _, err := utils.ParseCOSEKey(authData.PublicKey); err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadRequest
+		return response
+	}
+
+	now := time.Now()
+	credential := &models.WebAuthnCredential{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID,
+		CredentialID: authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		SignCount:    authData.SignCount,
+		Name:         input.Name,
+		CreatedAt:    now,
+		LastUsedAt:   now,
+	}
+
+	if err := ws.WebAuthnRepository.CreateWebAuthnCredential(ws.ctx, credential); err != nil {
+		if err.Error() == "credential already registered" {
+			response.Err = err
+			response.Message = err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusConflict
+			return response
+		}
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = credential
+
+	return response
+}
+
+func (ws *WebAuthnServiceImpl) BeginLogin(input *models.WebAuthnLoginOptionsInput) *models.AuthServiceResponse {
+
+	response := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	config, _ := config.LoadConfig(".")
+
+	var userId primitive.ObjectID
+	allowCredentials := []models.WebAuthnCredentialDescriptor{}
+
+	// Without an email the browser offers every discoverable passkey it has
+	// for this site. With one we narrow the choice down to the user's
+	// passkeys. Unknown emails and users without passkeys get made up
+	// passkeys, so the answer does not reveal whether the email is registered.
+	if input != nil && input.Email != "" {
+		user, err := ws.AuthRepository.FindUserByEmail(ws.ctx, input.Email)
+
+		if err != nil && err != mongo.ErrNoDocuments {
+			response.Err = err
+			response.Message = err.Error()
+			response.Status = "fail"
+			response.StatusCode = http.StatusBadGateway
+			return response
+		}
+
+		if err == nil {
+			credentials, err := ws.WebAuthnRepository.FindUserWebAuthnCredentials(ws.ctx, user.ID)
+
+			if err != nil {
+				response.Err = err
+				response.Message = err.Error()
+				response.Status = "fail"
+				response.StatusCode = http.StatusBadGateway
+				return response
+			}
+
+			userId = user.ID
+			allowCredentials = webAuthnDescriptors(credentials)
+		}
+
+		if len(allowCredentials) == 0 {
+			if allowCredentials, err = fakeWebAuthnDescriptors(input.Email); err != nil {
+				response.Err = err
+				response.Message = err.Error()
+				response.Status = "fail"
+				response.StatusCode = http.StatusInternalServerError
+				return response
+			}
+		}
+	}
+
+	challenge, err := ws.createChallenge(webAuthnAssertionType, userId)
+
+	if err != nil {
+		response.Err = err
+		response.Message = err.Error()
+		response.Status = "fail"
+		response.StatusCode = http.StatusBadGateway
+		return response
+	}
+
+	response.Data = models.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		RPID:             config.WebAuthnRPID,
+		AllowCredentials: allowCredentials,
+		UserVerification: "required",
+	}
+
+	return response
+}
+
+func (ws *WebAuthnServiceImpl) FinishLogin(input *models.WebAuthnAssertionInput, client models.ClientInfo) *models.AuthServiceResponse {
+
+	result := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+	}
+
+	var user *models.DBResponse
+	defer func() {
+		recordAudit(ws.ctx, ws.AuditRepository, models.AuditLoginPasskey, result, user, "", client)
+	}()
+
+	config, _ := config.LoadConfig(".")
+
+	if input.Type != webAuthnPublicKeyType {
+		result.Err = errors.New("invalid credential type")
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	clientDataJSON, errClientData := utils.DecodeWebAuthn(input.Response.ClientDataJSON)
+	rawAuthData, errAuthData := utils.DecodeWebAuthn(input.Response.AuthenticatorData)
+	signature, errSignature := utils.DecodeWebAuthn(input.Response.Signature)
+	credentialId, errCredentialId := utils.DecodeWebAuthn(input.ID)
+
+	if err := firstError(errClientData, errAuthData, errSignature, errCredentialId); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	challenge, err := utils.VerifyClientData(clientDataJSON, webAuthnAssertionType, config.WebAuthnOrigin)
+	if err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	stored, err := ws.WebAuthnRepository.ConsumeWebAuthnChallenge(ws.ctx, challenge, webAuthnAssertionType)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = "Invalid or expired challenge, please try again"
+			result.Err = err
+			return result
+		}
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	credential, err := ws.WebAuthnRepository.FindWebAuthnCredentialById(ws.ctx, credentialId)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = "Unknown passkey"
+			result.Err = err
+			return result
+		}
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if !stored.UserID.IsZero() && stored.UserID != credential.UserID {
+		result.Err = errors.New("passkey does not belong to this account")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	if input.Response.UserHandle != "" {
+		userHandle, err := utils.DecodeWebAuthn(input.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, credential.UserID[:]) {
+			result.Err = errors.New("passkey does not belong to this account")
+			result.Status = "fail"
+			result.StatusCode = http.StatusUnauthorized
+			result.Message = result.Err.Error()
+			return result
+		}
+	}
+
+	authData, err := utils.ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if err := verifyAuthenticatorFlags(authData, config.WebAuthnRPID); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if err := utils.VerifyAssertionSignature(credential.PublicKey, rawAuthData, clientDataJSON, signature); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	// A counter that does not move forward means the private key may have
+	// been cloned. Authenticators that do not count always report zero.
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		result.Err = errors.New("passkey signature counter did not increase")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	if err := ws.WebAuthnRepository.UpdateWebAuthnSignCount(ws.ctx, credential.ID, authData.SignCount); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	user, err = ws.AuthRepository.FindUserById(ws.ctx, credential.UserID)
+
+	if err != nil {
+		user = nil
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	if !user.Verified {
+		result.Err = errors.New("you have not verify the account , please verify your email to login ")
+		result.Status = "fail"
+		result.StatusCode = http.StatusUnauthorized
+		result.Message = result.Err.Error()
+		return result
+	}
+
+	if user.Disabled {
+		return accountDisabled(result)
+	}
+
+	if err := cancelAccountDeletion(ws.ctx, ws.AuthRepository, user); err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadGateway
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	access_token, refresh_token, err := startSession(ws.ctx, ws.SessionRepository, ws.RefreshTokenRepository, user, client)
+
+	if err != nil {
+		result.Status = "fail"
+		result.StatusCode = http.StatusBadRequest
+		result.Message = err.Error()
+		result.Err = err
+		return result
+	}
+
+	result.AccessToken = access_token
+	result.RefreshAccessToken = refresh_token
+
+	return result
+}
+
+func (ws *WebAuthnServiceImpl) createChallenge(challengeType string, userId primitive.ObjectID) (string, error) {
+	challenge, err := utils.GenerateWebAuthnChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	stored := &models.WebAuthnChallenge{
+		ID:        primitive.NewObjectID(),
+		Challenge: challenge,
+		Type:      challengeType,
+		UserID:    userId,
+		ExpiresAt: time.Now().Add(webAuthnTimeout),
+	}
+
+	if err := ws.WebAuthnRepository.CreateWebAuthnChallenge(ws.ctx, stored); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// verifyAuthenticatorFlags checks that the authenticator data was created for
+// this relying party and that the user was present and verified. A verified
+// passkey is two factors by itself, so no TOTP code is asked for afterwards.
+func verifyAuthenticatorFlags(authData *utils.AuthenticatorData, rpID string) error {
+	if !authData.VerifyRPIDHash(rpID) {
+		return errors.New("invalid relying party")
+	}
+
+	if authData.Flags&utils.WebAuthnFlagUserPresent == 0 || authData.Flags&utils.WebAuthnFlagUserVerified == 0 {
+		return errors.New("user verification is required")
+	}
+
+	return nil
+}
+
+func webAuthnUserHandle(userId primitive.ObjectID) string {
+	return utils.EncodeWebAuthn(userId[:])
+}
+
+func webAuthnDescriptors(credentials []*models.WebAuthnCredential) []models.WebAuthnCredentialDescriptor {
+	descriptors := make([]models.WebAuthnCredentialDescriptor, 0, len(credentials))
+
+	for _, credential := range credentials {
+		descriptors = append(descriptors, models.WebAuthnCredentialDescriptor{
+			Type: webAuthnPublicKeyType,
+			ID:   utils.EncodeWebAuthn(credential.CredentialID),
+		})
+	}
+
+	return descriptors
+}
+
+// fakeWebAuthnDescriptors makes up a passkey for an email without passkeys.
+// It is derived from the email, so asking twice gives the same answer.
+func fakeWebAuthnDescriptors(email string) ([]models.WebAuthnCredentialDescriptor, error) {
+	credentialId, err := utils.KeyedHash("webauthn-credential:" + strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.WebAuthnCredentialDescriptor{{
+		Type: webAuthnPublicKeyType,
+		ID:   utils.EncodeWebAuthn(credentialId),
+	}}, nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/mocks"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAdminService(t *testing.T) {
+	mockAuthRepository := new(mocks.MockAuthRepository)
+	mockRefreshTokenRepository := new(mocks.MockRefreshTokenRepository)
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	mockAuditRepository := new(mocks.MockAuditRepository)
+	mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.Anything).Return(nil)
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockDataExportRepository := new(mocks.MockDataExportRepository)
+	worker := services.NewAccountDeletionWorker(mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, mockWebAuthnRepository, mockAuditRepository, mockDataExportRepository, context.TODO())
+	as := services.NewAdminService(mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, mockAuditRepository, worker, context.TODO())
+
+	admin := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+
+	t.Run("List users", func(t *testing.T) {
+		verified := true
+		query := &models.UserListQuery{Email: "bo", Verified: &verified, Page: 2, Limit: 1}
+		users := []*models.DBResponse{{ID: primitive.NewObjectID(), Email: "bochuang@gmail.com", Password: "hash", Verified: true}}
+
+		mockAuthRepository.On("ListUsers", mock.Anything, query).Return(users, int64(3), nil)
+
+		response := as.ListUsers(query)
+		assert.NoError(t, response.Err)
+
+		list := response.Data.(models.UserListResponse)
+		assert.Equal(t, int64(3), list.Total)
+		assert.Equal(t, int64(2), list.Page)
+		assert.Equal(t, "bochuang@gmail.com", list.Users[0].Email)
+		assert.True(t, list.Users[0].Verified)
+	})
+
+	t.Run("Get unknown user", func(t *testing.T) {
+		id := primitive.NewObjectID()
+		mockAuthRepository.On("FindUserById", mock.Anything, id).Return(&models.DBResponse{}, mongo.ErrNoDocuments).Once()
+
+		response := as.GetUser(id.Hex())
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+		response = as.GetUser("not-an-id")
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+
+	t.Run("Change role revokes sessions", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleUser}
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Once()
+		mockAuthRepository.On("UpdateUserRole", mock.Anything, user.ID, models.RoleAdmin).Return(nil).Once()
+		mockSessionRepository.On("RevokeUserSessions", mock.Anything, user.ID).Return(nil).Once()
+		mockRefreshTokenRepository.On("RevokeUserRefreshTokens", mock.Anything, user.ID).Return(nil).Once()
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(&models.DBResponse{ID: user.ID, Role: models.RoleAdmin}, nil).Once()
+
+		response := as.UpdateUserRole(admin, user.ID.Hex(), models.RoleAdmin)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, models.RoleAdmin, response.Data.(models.UserResponse).Role)
+		mockSessionRepository.AssertCalled(t, "RevokeUserSessions", mock.Anything, user.ID)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeUserRefreshTokens", mock.Anything, user.ID)
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		response := as.UpdateUserRole(admin, primitive.NewObjectID().Hex(), "superuser")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("Role above own permissions", func(t *testing.T) {
+		support := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleUser}
+
+		response := as.UpdateUserRole(support, primitive.NewObjectID().Hex(), models.RoleAdmin)
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	})
+
+	t.Run("Lower role cannot change a higher role", func(t *testing.T) {
+		support := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleUser}
+		target := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+		mockAuthRepository.On("FindUserById", mock.Anything, target.ID).Return(target, nil).Times(3)
+
+		for _, response := range []*models.AuthServiceResponse{
+			as.UpdateUserRole(support, target.ID.Hex(), models.RoleUser),
+			as.SetUserDisabled(support, target.ID.Hex(), true),
+			as.DeleteUser(support, target.ID.Hex()),
+		} {
+			assert.Error(t, response.Err)
+			assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		}
+
+		mockAuthRepository.AssertNotCalled(t, "UpdateUserRole", mock.Anything, target.ID, models.RoleUser)
+		mockAuthRepository.AssertNotCalled(t, "SetUserDisabled", mock.Anything, target.ID, true)
+		mockAuthRepository.AssertNotCalled(t, "ScheduleUserDeletion", mock.Anything, target.ID, mock.Anything)
+	})
+
+	t.Run("Admin cannot change own account", func(t *testing.T) {
+		response := as.SetUserDisabled(admin, admin.ID.Hex(), true)
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "SetUserDisabled", mock.Anything, admin.ID, true)
+	})
+
+	t.Run("Disable revokes sessions", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Disabled: true}
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Once()
+		mockAuthRepository.On("SetUserDisabled", mock.Anything, user.ID, true).Return(nil).Once()
+		mockSessionRepository.On("RevokeUserSessions", mock.Anything, user.ID).Return(nil).Once()
+		mockRefreshTokenRepository.On("RevokeUserRefreshTokens", mock.Anything, user.ID).Return(nil).Once()
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Once()
+
+		response := as.SetUserDisabled(admin, user.ID.Hex(), true)
+		assert.NoError(t, response.Err)
+		assert.True(t, response.Data.(models.UserResponse).Disabled)
+		mockSessionRepository.AssertCalled(t, "RevokeUserSessions", mock.Anything, user.ID)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeUserRefreshTokens", mock.Anything, user.ID)
+	})
+
+	t.Run("Force verify", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		mockAuthRepository.On("ForceVerifyUser", mock.Anything, user.ID).Return(nil).Once()
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Twice()
+
+		response := as.VerifyUser(user.ID.Hex())
+		assert.NoError(t, response.Err)
+		assert.True(t, response.Data.(models.UserResponse).Verified)
+	})
+
+	t.Run("List audit events", func(t *testing.T) {
+		query := &models.AuditEventQuery{UserID: admin.ID.Hex(), Type: models.AuditLogin, Page: 1, Limit: 20}
+		events := []*models.AuditEvent{{ID: primitive.NewObjectID(), Type: models.AuditLogin, Outcome: models.AuditSuccess, ActorID: admin.ID}}
+		mockAuditRepository.On("ListAuditEvents", mock.Anything, query).Return(events, int64(1), nil).Once()
+
+		response := as.ListAuditEvents(query)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, models.AuditEventListResponse{Events: events, Total: 1, Page: 1, Limit: 20}, response.Data)
+	})
+
+	t.Run("List audit events with invalid user", func(t *testing.T) {
+		response := as.ListAuditEvents(&models.AuditEventQuery{UserID: "nope", Page: 1, Limit: 20})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("Unlock", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID()}
+		mockAuthRepository.On("ResetFailedLogins", mock.Anything, user.ID).Return(nil).Once()
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Twice()
+
+		response := as.UnlockUser(user.ID.Hex())
+		assert.NoError(t, response.Err)
+		assert.False(t, response.Data.(models.UserResponse).Locked)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "deleted@gmail.com"}
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Once()
+		mockAuthRepository.On("ScheduleUserDeletion", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockAuthRepository.On("MarkUserPurging", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockSessionRepository.On("DeleteUserSessions", mock.Anything, user.ID).Return(nil).Once()
+		mockRefreshTokenRepository.On("DeleteUserRefreshTokens", mock.Anything, user.ID).Return(nil).Once()
+		mockWebAuthnRepository.On("DeleteUserWebAuthnCredentials", mock.Anything, user.ID).Return(nil).Once()
+		mockDataExportRepository.On("DeleteUserDataExports", mock.Anything, user.ID).Return(nil).Once()
+		mockAuditRepository.On("AnonymizeAuditEvents", mock.Anything, user.ID, user.Email).Return(nil).Once()
+		mockAuthRepository.On("DeleteScheduledUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(&models.DBResponse{}, mongo.ErrNoDocuments).Once()
+
+		response := as.DeleteUser(admin, user.ID.Hex())
+		assert.NoError(t, response.Err)
+		assert.Nil(t, response.Data)
+		mockWebAuthnRepository.AssertExpectations(t)
+		mockDataExportRepository.AssertExpectations(t)
+	})
+
+	t.Run("Repository error", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID()}
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil).Once()
+		mockAuthRepository.On("ScheduleUserDeletion", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(errors.New("connection refused")).Once()
+
+		response := as.DeleteUser(admin, user.ID.Hex())
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadGateway, response.StatusCode)
+	})
+}
@@ -5,20 +5,24 @@ import (
 	"errors"
 	"html/template"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/mocks"
 	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/repository"
 	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestSignUp(t *testing.T) {
-	mockAuthRepository := new(mocks.MockAuthRepository)
-	ctx := context.TODO()
-	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewAuthService(mockAuthRepository, ctx, temp)
+	us, mockAuthRepository, _, _, _ := newAuthService()
 	t.Run("Success", func(t *testing.T) {
 		mockUser := &models.SignUpInput{
 			Name:            "Bo Chuang Jie",
@@ -49,7 +53,7 @@ func TestSignUp(t *testing.T) {
 
 		mockAuthRepository.On("SignUpUser", mockArgs1...).Return(mockUserResp, "12345678", nil)
 
-		response := us.SignUpUser(mockUser)
+		response := us.SignUpUser(mockUser, models.ClientInfo{})
 		assert.NoError(t, response.Err)
 		assert.Equal(t, response.Status, mockResponse.Status)
 		assert.Equal(t, response.StatusCode, mockResponse.StatusCode)
@@ -72,7 +76,7 @@ func TestSignUp(t *testing.T) {
 			Err:        errors.New("password not match"),
 		}
 
-		response := us.SignUpUser(mockUser)
+		response := us.SignUpUser(mockUser, models.ClientInfo{})
 		assert.Error(t, mockResponse.Err, response.Err)
 		assert.Equal(t, mockResponse, response)
 		mockAuthRepository.AssertNotCalled(t, "SignUpUser")
@@ -101,18 +105,33 @@ func TestSignUp(t *testing.T) {
 
 		mockAuthRepository.On("SignUpUser", mockArgs1...).Return(&models.DBResponse{}, "", errors.New("user with that email already exist"))
 
-		response := us.SignUpUser(mockUser)
+		response := us.SignUpUser(mockUser, models.ClientInfo{})
 		assert.Error(t, mockResponse.Err, response.Err)
 		assert.Equal(t, mockResponse, response)
 		mockAuthRepository.AssertExpectations(t)
 	})
 }
 
+func TestSignUpPasswordPolicy(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newAuthService()
+
+	mockUser := &models.SignUpInput{
+		Name:            "Bo Chuang Jie",
+		Email:           "bochuangjie@gmail.com",
+		Password:        "jie1",
+		PasswordConfirm: "jie1",
+	}
+
+	response := us.SignUpUser(mockUser, models.ClientInfo{})
+
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Equal(t, "password must be at least 8 characters long; password must not contain your name", response.Message)
+	mockAuthRepository.AssertNotCalled(t, "SignUpUser", mock.Anything, mock.Anything)
+}
+
 func TestSignIn(t *testing.T) {
-	mockAuthRepository := new(mocks.MockAuthRepository)
-	ctx := context.TODO()
-	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewAuthService(mockAuthRepository, ctx, temp)
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+	acceptPasswordUpgrades(mockAuthRepository)
 
 	t.Run("Success", func(t *testing.T) {
 		mockUser := &models.SignInInput{
@@ -140,9 +159,12 @@ func TestSignIn(t *testing.T) {
 		}
 
 		mockAuthRepository.On("FindUserByEmail", mockArgs1...).Return(mockUserResp, nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
 
-		response := us.SignInUser(mockUser)
+		response := us.SignInUser(mockUser, models.ClientInfo{})
 		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.RefreshAccessToken)
 		assert.Equal(t, response.Status, mockResponse.Status)
 		assert.Equal(t, response.StatusCode, mockResponse.StatusCode)
 		mockAuthRepository.AssertExpectations(t)
@@ -176,7 +198,7 @@ func TestSignIn(t *testing.T) {
 
 		mockAuthRepository.On("FindUserByEmail", mockArgs...).Return(mockAuthResponse, nil)
 
-		response := us.SignInUser(mockUser)
+		response := us.SignInUser(mockUser, models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.Equal(t, response.Status, mockResponse.Status)
 		assert.Equal(t, response.StatusCode, mockResponse.StatusCode)
@@ -210,7 +232,7 @@ func TestSignIn(t *testing.T) {
 
 		mockAuthRepository.On("FindUserByEmail", mockArgs...).Return(mockAuthResponse, nil)
 
-		response := us.SignInUser(mockUser)
+		response := us.SignInUser(mockUser, models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.Equal(t, response.Status, mockResponse.Status)
 		assert.Equal(t, response.StatusCode, mockResponse.StatusCode)
@@ -218,3 +240,591 @@ func TestSignIn(t *testing.T) {
 
 	})
 }
+
+func TestTwoFactorSignIn(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, mockAuditRepository := newAuthService()
+	acceptPasswordUpgrades(mockAuthRepository)
+
+	config, _ := config.LoadConfig(".")
+	secret, _ := utils.GenerateTOTPSecret()
+	encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+
+	t.Run("Login returns MFA challenge", func(t *testing.T) {
+		mockUser := &models.SignInInput{
+			Email:    "twofactor@gmail.com",
+			Password: "12345678",
+		}
+
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			Email:            "twofactor@gmail.com",
+			Verified:         true,
+			Password:         "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK",
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+		}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, mockUser.Email).Return(mockUserResp, nil)
+		mockAuthRepository.On("CreateMFAChallenge", mock.Anything, mockUserResp.ID, mock.AnythingOfType("time.Time")).Return("challenge", nil)
+
+		response := us.SignInUser(mockUser, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, "challenge", response.MFAToken)
+		assert.Empty(t, response.AccessToken)
+		assert.Empty(t, response.RefreshAccessToken)
+		mockSessionRepository.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+		mockAuditRepository.AssertCalled(t, "CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.Type == models.AuditLoginMFAChallenge && event.ActorID == mockUserResp.ID
+		}))
+		mockAuditRepository.AssertNotCalled(t, "CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.Type == models.AuditLogin && event.ActorID == mockUserResp.ID
+		}))
+	})
+
+	t.Run("Valid code issues tokens", func(t *testing.T) {
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+		}
+		now := time.Now()
+		code, _ := utils.TOTPCode(secret, now)
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "valid-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(nil)
+		mockAuthRepository.On("UseTOTPCounter", mock.Anything, mockUserResp.ID, now.Unix()/30).Return(nil)
+		mockAuthRepository.On("ClearMFAChallenge", mock.Anything, mockUserResp.ID).Return(nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "valid-challenge", Code: code}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NotEmpty(t, response.AccessToken)
+		assert.NotEmpty(t, response.RefreshAccessToken)
+	})
+
+	t.Run("Replayed code is rejected", func(t *testing.T) {
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+		}
+		code, _ := utils.TOTPCode(secret, time.Now())
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "replay-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(nil)
+		mockAuthRepository.On("UseTOTPCounter", mock.Anything, mockUserResp.ID, mock.Anything).Return(repository.ErrTOTPCodeUsed)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "replay-challenge", Code: code}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Empty(t, response.AccessToken)
+		mockAuthRepository.AssertNotCalled(t, "ClearMFAChallenge", mock.Anything, mockUserResp.ID)
+	})
+
+	t.Run("Invalid code counts attempt", func(t *testing.T) {
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+		}
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "retry-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(nil)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "retry-challenge", Code: "000000x"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5)
+		mockAuthRepository.AssertNotCalled(t, "ClearMFAChallenge", mock.Anything, mockUserResp.ID)
+	})
+
+	t.Run("Too many attempts discard challenge", func(t *testing.T) {
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+		}
+		code, _ := utils.TOTPCode(secret, time.Now())
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "last-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(repository.ErrTooManyAttempts)
+		mockAuthRepository.On("ClearMFAChallenge", mock.Anything, mockUserResp.ID).Return(nil)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "last-challenge", Code: code}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Empty(t, response.AccessToken)
+		mockAuthRepository.AssertCalled(t, "ClearMFAChallenge", mock.Anything, mockUserResp.ID)
+		mockAuthRepository.AssertNotCalled(t, "UseTOTPCounter", mock.Anything, mockUserResp.ID, mock.Anything)
+	})
+
+	t.Run("Recovery code issues tokens", func(t *testing.T) {
+		hashedCode, _ := utils.HashPassword("abcde-fghij")
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			Email:            "twofactor@gmail.com",
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+			RecoveryCodes:    []string{hashedCode},
+		}
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "recovery-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(nil)
+		mockAuthRepository.On("UseRecoveryCode", mock.Anything, mockUserResp.ID, hashedCode).Return(nil)
+		mockAuthRepository.On("ClearMFAChallenge", mock.Anything, mockUserResp.ID).Return(nil)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "recovery-challenge", RecoveryCode: "ABCDE-FGHIJ"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.AccessToken)
+		mockAuthRepository.AssertCalled(t, "UseRecoveryCode", mock.Anything, mockUserResp.ID, hashedCode)
+	})
+
+	t.Run("Used recovery code is rejected", func(t *testing.T) {
+		hashedCode, _ := utils.HashPassword("abcde-fghij")
+		mockUserResp := &models.DBResponse{
+			ID:               primitive.NewObjectID(),
+			TwoFactorEnabled: true,
+			TwoFactorSecret:  encryptedSecret,
+			RecoveryCodes:    []string{hashedCode},
+		}
+
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "used-recovery-challenge").Return(mockUserResp, nil)
+		mockAuthRepository.On("UseRecoveryCode", mock.Anything, mockUserResp.ID, hashedCode).Return(repository.ErrRecoveryCodeUsed)
+		mockAuthRepository.On("IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5).Return(nil)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "used-recovery-challenge", RecoveryCode: "abcde-fghij"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "IncrementMFAChallengeAttempts", mock.Anything, mockUserResp.ID, 5)
+	})
+
+	t.Run("Expired challenge", func(t *testing.T) {
+		mockAuthRepository.On("FindUserByMFAChallenge", mock.Anything, "expired").Return(nil, mongo.ErrNoDocuments)
+
+		response := us.VerifyMFA(&models.MFAChallengeInput{MFAToken: "expired", Code: "123456"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+}
+
+func TestMagicLink(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+
+	t.Run("Unknown email gets the same answer", func(t *testing.T) {
+		mockAuthRepository.On("CreateMagicLinkToken", mock.Anything, "nobody@gmail.com").Return(&models.DBResponse{}, "", mongo.ErrNoDocuments)
+		mockAuthRepository.On("CreateMagicLinkToken", mock.Anything, "bochuang@gmail.com").Return(&models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com", Verified: true}, "token", nil)
+
+		unknown := us.RequestMagicLink("nobody@gmail.com")
+		known := us.RequestMagicLink("bochuang@gmail.com")
+
+		assert.NoError(t, unknown.Err)
+		assert.NoError(t, known.Err)
+		assert.Equal(t, known.StatusCode, unknown.StatusCode)
+		assert.Equal(t, known.Message, unknown.Message)
+	})
+
+	t.Run("Valid link issues tokens", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+
+		mockAuthRepository.On("ConsumeMagicLinkToken", mock.Anything, "valid-link").Return(user, nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+		response := us.SignInWithMagicLink("valid-link", models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.AccessToken)
+		assert.NotEmpty(t, response.RefreshAccessToken)
+	})
+
+	t.Run("Two factor user gets MFA challenge", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, TwoFactorEnabled: true}
+
+		mockAuthRepository.On("ConsumeMagicLinkToken", mock.Anything, "two-factor-link").Return(user, nil)
+		mockAuthRepository.On("CreateMFAChallenge", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return("challenge", nil)
+
+		response := us.SignInWithMagicLink("two-factor-link", models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, "challenge", response.MFAToken)
+		assert.Empty(t, response.AccessToken)
+	})
+
+	t.Run("Disabled account", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, Disabled: true}
+
+		mockAuthRepository.On("ConsumeMagicLinkToken", mock.Anything, "disabled-link").Return(user, nil)
+
+		response := us.SignInWithMagicLink("disabled-link", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	})
+
+	t.Run("Used or expired link", func(t *testing.T) {
+		mockAuthRepository.On("ConsumeMagicLinkToken", mock.Anything, "used-link").Return(nil, errors.New("invalid or expired token"))
+
+		response := us.SignInWithMagicLink("used-link", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+}
+
+func TestEmailOTP(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+
+	hashedCode, _ := utils.HashPassword("123456")
+
+	t.Run("Request stores hashed code", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "otp@gmail.com", Verified: true}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "otp@gmail.com").Return(user, nil).Once()
+		mockAuthRepository.On("SetEmailOTP", mock.Anything, user.ID, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		response := us.RequestEmailOTP("otp@gmail.com")
+		assert.NoError(t, response.Err)
+
+		stored := mockAuthRepository.Calls[len(mockAuthRepository.Calls)-1].Arguments
+		assert.NotEmpty(t, stored.String(2))
+		assert.True(t, stored.Get(3).(time.Time).After(time.Now()))
+	})
+
+	t.Run("Request for unknown email gets the same answer", func(t *testing.T) {
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "nobody@gmail.com").Return(&models.DBResponse{}, mongo.ErrNoDocuments).Once()
+
+		response := us.RequestEmailOTP("nobody@gmail.com")
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "You will receive a sign in code if user with that email exist", response.Message)
+	})
+
+	t.Run("Valid code issues tokens", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, EmailOTPCode: hashedCode, EmailOTPAt: time.Now().Add(time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "otp@gmail.com").Return(user, nil).Once()
+		mockAuthRepository.On("IncrementEmailOTPAttempts", mock.Anything, user.ID, 5).Return(nil).Once()
+		mockAuthRepository.On("ClearEmailOTP", mock.Anything, user.ID).Return(nil).Once()
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+		response := us.SignInWithEmailOTP(&models.EmailOTPInput{Email: "otp@gmail.com", Code: "123456"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.AccessToken)
+		mockAuthRepository.AssertCalled(t, "ClearEmailOTP", mock.Anything, user.ID)
+	})
+
+	t.Run("Wrong code counts attempt", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, EmailOTPCode: hashedCode, EmailOTPAt: time.Now().Add(time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "otp@gmail.com").Return(user, nil).Once()
+		mockAuthRepository.On("IncrementEmailOTPAttempts", mock.Anything, user.ID, 5).Return(nil).Once()
+
+		response := us.SignInWithEmailOTP(&models.EmailOTPInput{Email: "otp@gmail.com", Code: "654321"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Equal(t, "Invalid or expired code", response.Message)
+		mockAuthRepository.AssertNotCalled(t, "ClearEmailOTP", mock.Anything, user.ID)
+	})
+
+	t.Run("Too many attempts discard code", func(t *testing.T) {
+		// The stale count read with the user does not matter, the increment
+		// refuses the attempt.
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, EmailOTPCode: hashedCode, EmailOTPAt: time.Now().Add(time.Minute), EmailOTPAttempts: 0}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "otp@gmail.com").Return(user, nil).Once()
+		mockAuthRepository.On("IncrementEmailOTPAttempts", mock.Anything, user.ID, 5).Return(repository.ErrTooManyAttempts).Once()
+		mockAuthRepository.On("ClearEmailOTP", mock.Anything, user.ID).Return(nil).Once()
+
+		response := us.SignInWithEmailOTP(&models.EmailOTPInput{Email: "otp@gmail.com", Code: "123456"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Empty(t, response.AccessToken)
+		mockAuthRepository.AssertCalled(t, "ClearEmailOTP", mock.Anything, user.ID)
+	})
+
+	t.Run("Expired code", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true, EmailOTPCode: hashedCode, EmailOTPAt: time.Now().Add(-time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "otp@gmail.com").Return(user, nil).Once()
+
+		response := us.SignInWithEmailOTP(&models.EmailOTPInput{Email: "otp@gmail.com", Code: "123456"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+}
+
+func TestAccountLockout(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+	acceptPasswordUpgrades(mockAuthRepository)
+
+	password := "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"
+
+	t.Run("Wrong password counts attempt", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "lock1@gmail.com", Verified: true, Password: password}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(1, nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "wrong-password"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "LockUser", mock.Anything, user.ID, mock.Anything)
+	})
+
+	t.Run("Too many wrong passwords lock with backoff", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "lock2@gmail.com", Verified: true, Password: password, LockoutCount: 2}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(5, nil)
+		mockAuthRepository.On("LockUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "wrong-password"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+
+		lockedUntil := mockAuthRepository.Calls[len(mockAuthRepository.Calls)-1].Arguments.Get(2).(time.Time)
+		assert.WithinDuration(t, time.Now().Add(4*time.Minute), lockedUntil, 5*time.Second)
+	})
+
+	t.Run("Locked account is rejected", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "lock3@gmail.com", Verified: true, Password: password, LockedUntil: time.Now().Add(time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "RecordFailedLogin", mock.Anything, user.ID)
+	})
+
+	t.Run("Successful login resets counter", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "lock4@gmail.com", Verified: true, Password: password, FailedLoginAttempts: 3, LockedUntil: time.Now().Add(-time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("ResetFailedLogins", mock.Anything, user.ID).Return(nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		mockAuthRepository.AssertCalled(t, "ResetFailedLogins", mock.Anything, user.ID)
+	})
+}
+
+func TestPasswordRehash(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+
+	mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+	mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+	t.Run("bcrypt hash is upgraded", func(t *testing.T) {
+		bcryptHash := "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "rehash1@gmail.com", Verified: true, Password: bcryptHash}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("UpdatePasswordHash", mock.Anything, user.ID, bcryptHash, mock.MatchedBy(func(hash string) bool {
+			return strings.HasPrefix(hash, "$argon2id$") && utils.VerifyPassword(hash, "12345678") == nil
+		})).Return(nil).Once()
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockAuthRepository.AssertExpectations(t)
+	})
+
+	t.Run("Failed upgrade does not block sign in", func(t *testing.T) {
+		weak, _ := utils.NewArgon2idHasher(16*1024, 2, 1).Hash("12345678")
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "rehash2@gmail.com", Verified: true, Password: weak}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("UpdatePasswordHash", mock.Anything, user.ID, weak, mock.Anything).Return(errors.New("connection reset")).Once()
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("Current hash is kept", func(t *testing.T) {
+		hash, _ := utils.HashPassword("12345678")
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "rehash3@gmail.com", Verified: true, Password: hash}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+
+		assert.NoError(t, response.Err)
+		mockAuthRepository.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, user.ID, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+
+	var session *models.Session
+	mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Run(func(args mock.Arguments) {
+		session = args.Get(1).(*models.Session)
+	}).Return(nil)
+	mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+	password, _ := utils.HashPassword("12345678")
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "claims@gmail.com", Verified: true, Role: models.RoleAdmin, Password: password}
+	mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+	response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+	assert.NoError(t, response.Err)
+
+	ring, err := utils.LoadAccessTokenKeyRing()
+	assert.NoError(t, err)
+
+	claims, err := utils.ValidateToken(response.AccessToken, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID.Hex(), claims.Subject)
+	assert.Equal(t, session.ID.Hex(), claims.SessionID)
+	assert.Equal(t, models.RoleAdmin, claims.Role)
+	assert.True(t, claims.HasScope(models.PermissionAll))
+	assert.Len(t, claims.ID, 32)
+}
+
+func TestAccountDeletionCancelledOnLogin(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newAuthService()
+	acceptPasswordUpgrades(mockAuthRepository)
+
+	password := "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"
+	mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+	mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+	t.Run("Scheduled deletion is cancelled", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "leaving@gmail.com", Verified: true, Password: password, DeletionScheduledAt: time.Now().Add(time.Hour)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("CancelUserDeletion", mock.Anything, user.ID).Return(nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.AccessToken)
+		mockAuthRepository.AssertCalled(t, "CancelUserDeletion", mock.Anything, user.ID)
+	})
+
+	t.Run("Purge has started", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "purging@gmail.com", Verified: true, Password: password, DeletionScheduledAt: time.Now().Add(-time.Minute)}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("CancelUserDeletion", mock.Anything, user.ID).Return(mongo.ErrNoDocuments)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Empty(t, response.AccessToken)
+	})
+
+	t.Run("Nothing to cancel", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "staying@gmail.com", Verified: true, Password: password}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		mockAuthRepository.AssertNotCalled(t, "CancelUserDeletion", mock.Anything, user.ID)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newAuthService()
+
+	message := "You will receive a new verification email if an unverified user with that email exist"
+
+	t.Run("Unverified user", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "pending@gmail.com"}
+		mockAuthRepository.On("ResendVerificationCode", mock.Anything, user.Email).Return(user, "new-code", nil)
+
+		response := us.ResendVerification(user.Email, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, message, response.Message)
+	})
+
+	t.Run("Unknown or verified user", func(t *testing.T) {
+		mockAuthRepository.On("ResendVerificationCode", mock.Anything, "nobody@gmail.com").Return(nil, "", mongo.ErrNoDocuments)
+
+		response := us.ResendVerification("nobody@gmail.com", models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, message, response.Message)
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		mockAuthRepository.On("ResendVerificationCode", mock.Anything, "down@gmail.com").Return(nil, "", errors.New("connection refused"))
+
+		response := us.ResendVerification("down@gmail.com", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadGateway, response.StatusCode)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	mockAuthRepository := new(mocks.MockAuthRepository)
+	ctx := context.TODO()
+	temp := template.Must(template.ParseGlob("../templates/*.html"))
+	mockRefreshTokenRepository := new(mocks.MockRefreshTokenRepository)
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	mockAuditRepository := new(mocks.MockAuditRepository)
+	us := services.NewAuthService(mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, mockAuditRepository, ctx, temp)
+	acceptPasswordUpgrades(mockAuthRepository)
+
+	client := models.ClientInfo{IP: "10.0.0.1", UserAgent: "Mozilla/5.0"}
+	password := "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"
+
+	t.Run("Failed login", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "audit1@gmail.com", Verified: true, Password: password}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(1, nil)
+		mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.ActorID == user.ID
+		})).Return(nil).Once()
+
+		us.SignInUser(&models.SignInInput{Email: user.Email, Password: "wrong-password"}, client)
+
+		event := mockAuditRepository.Calls[len(mockAuditRepository.Calls)-1].Arguments.Get(1).(*models.AuditEvent)
+		assert.Equal(t, models.AuditLogin, event.Type)
+		assert.Equal(t, models.AuditFailure, event.Outcome)
+		assert.Equal(t, "Invalid Email or Password", event.Reason)
+		assert.Equal(t, user.Email, event.Email)
+		assert.Equal(t, client.IP, event.IP)
+		assert.Equal(t, client.UserAgent, event.UserAgent)
+		assert.False(t, event.CreatedAt.IsZero())
+	})
+
+	t.Run("Unknown email", func(t *testing.T) {
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "Stranger@gmail.com").Return(&models.DBResponse{}, mongo.ErrNoDocuments)
+		mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.Email == "stranger@gmail.com"
+		})).Return(nil).Once()
+
+		us.SignInUser(&models.SignInInput{Email: "Stranger@gmail.com", Password: "12345678"}, client)
+
+		event := mockAuditRepository.Calls[len(mockAuditRepository.Calls)-1].Arguments.Get(1).(*models.AuditEvent)
+		assert.Equal(t, models.AuditFailure, event.Outcome)
+		assert.True(t, event.ActorID.IsZero())
+	})
+
+	t.Run("Successful login", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "audit2@gmail.com", Verified: true, Password: password}
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.MatchedBy(func(session *models.Session) bool {
+			return session.UserID == user.ID && session.IP == client.IP && session.UserAgent == client.UserAgent
+		})).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+		mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.ActorID == user.ID
+		})).Return(errors.New("db error")).Once()
+
+		response := us.SignInUser(&models.SignInInput{Email: user.Email, Password: "12345678"}, client)
+		assert.NoError(t, response.Err)
+
+		event := mockAuditRepository.Calls[len(mockAuditRepository.Calls)-1].Arguments.Get(1).(*models.AuditEvent)
+		assert.Equal(t, models.AuditSuccess, event.Outcome)
+		assert.Empty(t, event.Reason)
+	})
+}
@@ -5,29 +5,47 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/controllers"
 	"github.com/tonybobo/auth-template/mocks"
 	"github.com/tonybobo/auth-template/models"
 	"github.com/tonybobo/auth-template/routes"
 	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var (
-	mockAuthService     = new(mocks.MockAuthService)
-	mockUserService     = new(mocks.MockUserService)
-	ctx                 = context.TODO()
-	authController      = controllers.NewAuthController(mockAuthService, mockUserService, ctx)
-	authRouteController = routes.NewAuthRouteController(authController)
-	userController      = controllers.NewUserController(mockUserService)
-	userRouteController = routes.NewUserRouteController(userController)
-	server              = gin.Default()
-	router              = server.Group("/api")
+	mockAuthService       = new(mocks.MockAuthService)
+	mockUserService       = new(mocks.MockUserService)
+	ctx                   = context.TODO()
+	authController        = controllers.NewAuthController(mockAuthService, mockUserService, ctx)
+	authRouteController   = routes.NewAuthRouteController(authController, utils.NewMemoryRateLimiter())
+	userController        = controllers.NewUserController(mockUserService)
+	userRouteController   = routes.NewUserRouteController(userController)
+	mockWebAuthnService   = new(mocks.MockWebAuthnService)
+	webAuthnController    = controllers.NewWebAuthnController(mockWebAuthnService)
+	webAuthnRoute         = routes.NewWebAuthnRouteController(webAuthnController)
+	mockAdminService      = new(mocks.MockAdminService)
+	adminController       = controllers.NewAdminController(mockAdminService)
+	adminRouteController  = routes.NewAdminRouteController(adminController)
+	mockExportService     = new(mocks.MockExportService)
+	exportController      = controllers.NewExportController(mockExportService)
+	exportRouteController = routes.NewExportRouteController(exportController, utils.NewMemoryRateLimiter())
+	mockKeyService        = new(mocks.MockKeyService)
+	keyController         = controllers.NewKeyController(mockKeyService)
+	keyRouteController    = routes.NewKeyRouteController(keyController)
+	server                = gin.Default()
+	router                = server.Group("/api")
 )
 
 func TestAuth(t *testing.T) {
@@ -71,7 +89,7 @@ func TestSignUpUser(t *testing.T) {
 
 		assert.NoError(t, err)
 
-		mockAuthService.On("SignUpUser", user).Return(mockResp)
+		mockAuthService.On("SignUpUser", user, mock.Anything).Return(mockResp)
 
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(reqBody))
@@ -118,7 +136,7 @@ func TestSignUpUser(t *testing.T) {
 
 		assert.NoError(t, err)
 
-		mockAuthService.On("SignUpUser", user).Return(mockResp)
+		mockAuthService.On("SignUpUser", user, mock.Anything).Return(mockResp)
 
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(reqBody))
@@ -154,7 +172,7 @@ func TestRefreshToken(t *testing.T) {
 			AccessToken: "testing",
 		}
 
-		mockUserService.On("RefreshAccessToken", cookie).Return(mockResp)
+		mockUserService.On("RefreshAccessToken", cookie, mock.Anything).Return(mockResp)
 
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
@@ -180,6 +198,39 @@ func TestRefreshToken(t *testing.T) {
 
 	})
 
+	t.Run("rotated refresh token is returned", func(t *testing.T) {
+		cookie := "old-refresh-token"
+
+		mockResp := &models.AuthServiceResponse{
+			Status:             "success",
+			StatusCode:         http.StatusOK,
+			AccessToken:        "testing",
+			RefreshAccessToken: "new-refresh-token",
+		}
+
+		mockUserService.On("RefreshAccessToken", cookie, mock.Anything).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: cookie})
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status":        mockResp.Status,
+			"access_token":  mockResp.AccessToken,
+			"refresh_token": mockResp.RefreshAccessToken,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		assert.Contains(t, strings.Join(w.Header().Values("Set-Cookie"), "\n"), "refresh_token="+mockResp.RefreshAccessToken)
+	})
+
 	t.Run("no cookie in request", func(t *testing.T) {
 		mockResp := &models.AuthServiceResponse{
 			Status:     "fail",
@@ -218,7 +269,7 @@ func TestRefreshToken(t *testing.T) {
 			Err:        errors.New("invalid token"),
 		}
 
-		mockUserService.On("RefreshAccessToken", cookie).Return(mockResp)
+		mockUserService.On("RefreshAccessToken", cookie, mock.Anything).Return(mockResp)
 
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
@@ -249,14 +300,13 @@ func TestVerifyEmailController(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
 		code := "1234423"
-		verificationCode := utils.Encode(code)
 		mockResp := &models.AuthServiceResponse{
 			Status:     "success",
 			StatusCode: http.StatusOK,
 			Message:    "Successfully Verified",
 		}
 
-		mockUserService.On("VerifyEmail", verificationCode).Return(mockResp)
+		mockUserService.On("VerifyEmail", code, mock.Anything).Return(mockResp)
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/api/auth/verifyemail/"+code, nil)
 
@@ -281,14 +331,13 @@ func TestVerifyEmailController(t *testing.T) {
 
 	t.Run("invalid code", func(t *testing.T) {
 		code := "123443"
-		verificationCode := utils.Encode(code)
 		mockResp := &models.AuthServiceResponse{
 			Status:     "fail",
 			StatusCode: http.StatusForbidden,
 			Message:    "invalid email",
 			Err:        errors.New("invalid email"),
 		}
-		mockUserService.On("VerifyEmail", verificationCode).Return(mockResp)
+		mockUserService.On("VerifyEmail", code, mock.Anything).Return(mockResp)
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodGet, "/api/auth/verifyemail/"+code, nil)
 
@@ -312,6 +361,49 @@ func TestVerifyEmailController(t *testing.T) {
 	})
 }
 
+func TestResendVerificationController(t *testing.T) {
+	mockResp := &models.AuthServiceResponse{
+		Status:     "success",
+		StatusCode: http.StatusOK,
+		Message:    "You will receive a new verification email if an unverified user with that email exist",
+	}
+
+	mockAuthService.On("ResendVerification", "stuck@gmail.com", mock.Anything).Return(mockResp)
+
+	resend := func(ip string) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(gin.H{"email": "stuck@gmail.com"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/resend-verification", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.RemoteAddr = ip + ":1234"
+
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("success", func(t *testing.T) {
+		w := resend("10.1.0.1")
+
+		respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("throttled per address", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, resend("10.1.0.2").Code)
+		assert.Equal(t, http.StatusOK, resend("10.1.0.3").Code)
+
+		w := resend("10.1.0.4")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		mockAuthService.AssertNumberOfCalls(t, "ResendVerification", 3)
+	})
+}
+
 func TestForgetPasswordController(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mockCredential := &models.ForgetPasswordInput{
@@ -328,7 +420,7 @@ func TestForgetPasswordController(t *testing.T) {
 		})
 
 		assert.NoError(t, err)
-		mockUserService.On("ForgetPassword", mockCredential.Email).Return(mockResp)
+		mockUserService.On("ForgetPassword", mockCredential.Email, mock.Anything).Return(mockResp)
 
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest(http.MethodPost, "/api/auth/forgotpassword", bytes.NewBuffer(reqBody))
@@ -395,7 +487,7 @@ func TestResetPasswordController(t *testing.T) {
 			StatusCode: http.StatusOK,
 			Message:    "Password updated successfully. Please Login with new password",
 		}
-		mockUserService.On("ResetPassword", userCredential, resetToken).Return(mockResponse)
+		mockUserService.On("ResetPassword", userCredential, resetToken, mock.Anything).Return(mockResponse)
 
 		reqBody, err := json.Marshal(gin.H{
 			"password":        userCredential.Password,
@@ -437,7 +529,7 @@ func TestResetPasswordController(t *testing.T) {
 			StatusCode: http.StatusBadRequest,
 			Message:    "Password does not match",
 		}
-		mockUserService.On("ResetPassword", userCredential, resetToken).Return(mockResponse)
+		mockUserService.On("ResetPassword", userCredential, resetToken, mock.Anything).Return(mockResponse)
 
 		reqBody, err := json.Marshal(gin.H{
 			"password":        userCredential.Password,
@@ -468,3 +560,871 @@ func TestResetPasswordController(t *testing.T) {
 		mockUserService.AssertExpectations(t)
 	})
 }
+
+func TestLogoutController(t *testing.T) {
+	config, _ := config.LoadConfig(".")
+
+	t.Run("revoke current session", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+		accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+		}
+
+		mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+		mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+		mockUserService.On("Logout", session.ID.Hex()).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status": mockResp.Status,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		mockUserService.AssertCalled(t, "Logout", session.ID.Hex())
+	})
+
+	t.Run("revoke every session", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+		accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+		}
+
+		mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+		mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+		mockUserService.On("LogoutEverywhere", user.ID.Hex()).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/logout/all", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserService.AssertCalled(t, "LogoutEverywhere", user.ID.Hex())
+	})
+
+	t.Run("revoked session is rejected", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID, Revoked: true}
+
+		accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+		mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockUserService.AssertNotCalled(t, "Logout", session.ID.Hex())
+	})
+
+	t.Run("expired access token with a refresh token", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+		accessToken, err := utils.CreateTokenWithClaims(-time.Minute, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockUserService.On("LogoutRefreshToken", "live-refresh-token").Return(&models.AuthServiceResponse{Status: "success", StatusCode: http.StatusOK}).Once()
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "live-refresh-token"})
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserService.AssertCalled(t, "LogoutRefreshToken", "live-refresh-token")
+		mockUserService.AssertNotCalled(t, "Logout", session.ID.Hex())
+		assert.Contains(t, strings.Join(w.Header().Values("Set-Cookie"), "\n"), "refresh_token=;")
+	})
+
+	t.Run("invalid refresh token falls back to the access token", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+		accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+		mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+		mockUserService.On("LogoutRefreshToken", "stale-refresh-token").Return(&models.AuthServiceResponse{Status: "fail", StatusCode: http.StatusForbidden, Err: errors.New("invalid token")}).Once()
+		mockUserService.On("Logout", session.ID.Hex()).Return(&models.AuthServiceResponse{Status: "success", StatusCode: http.StatusOK}).Once()
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "stale-refresh-token"})
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserService.AssertCalled(t, "Logout", session.ID.Hex())
+	})
+}
+
+func TestSessionsController(t *testing.T) {
+	userRouteController.UserRoute(router, mockUserService)
+	config, _ := config.LoadConfig(".")
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+	session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+	accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+	assert.NoError(t, err)
+
+	mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+	mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+
+	t.Run("list sessions", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Data:       []models.SessionResponse{{ID: session.ID, Device: "Chrome on macOS", Current: true}},
+		}
+
+		mockUserService.On("ListSessions", user, session.ID).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/users/me/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": "success", "data": mockResp.Data})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("change password", func(t *testing.T) {
+		input := &models.ChangePasswordInput{CurrentPassword: "12345678", Password: "new-password", PasswordConfirm: "new-password"}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Message:    "Password updated successfully. Other sessions have been signed out",
+		}
+
+		mockUserService.On("ChangePassword", user, session.ID, input, mock.Anything).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{"currentPassword": input.CurrentPassword, "password": input.Password, "passwordConfirm": input.PasswordConfirm})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/api/users/me/password", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("change password requires the current password", func(t *testing.T) {
+		reqBody, err := json.Marshal(gin.H{"password": "new-password", "passwordConfirm": "new-password"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/api/users/me/password", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("update profile", func(t *testing.T) {
+		name := "Tony Bo"
+		email := "tony@gmail.com"
+		input := &models.UpdateProfileInput{Name: &name, Email: &email}
+		updated := &models.DBResponse{ID: user.ID, Name: name, PendingEmail: email, Verified: true}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Message:    "Profile updated. Please confirm your new email with the link we sent to it",
+			User:       updated,
+		}
+
+		mockUserService.On("UpdateProfile", user, input).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{"name": name, "email": email})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/api/users/me", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message, "data": gin.H{"user": models.FilteredResponse(updated)}})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("update profile rejects an invalid email", func(t *testing.T) {
+		reqBody, err := json.Marshal(gin.H{"email": "not-an-email"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/api/users/me", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("delete account", func(t *testing.T) {
+		input := &models.DeleteAccountInput{Password: "12345678"}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Message:    "Your account will be deleted on Mon, 16 Nov 2026 10:00:00 UTC. Sign in again before then to cancel the deletion",
+		}
+
+		mockUserService.On("DeleteAccount", user, input, mock.Anything).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{"password": input.Password})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodDelete, "/api/users/me", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		assert.Contains(t, w.Header().Values("Set-Cookie"), "access_token=; Path=/; Domain=localhost; Max-Age=0; HttpOnly")
+	})
+
+	t.Run("delete account requires the password", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodDelete, "/api/users/me", bytes.NewBufferString("{}"))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("revoke session", func(t *testing.T) {
+		id := primitive.NewObjectID().Hex()
+		mockResp := &models.AuthServiceResponse{
+			Status:     "fail",
+			StatusCode: http.StatusNotFound,
+			Message:    "session not found",
+			Err:        errors.New("session not found"),
+		}
+
+		mockUserService.On("RevokeSession", user, id).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodDelete, "/api/users/me/sessions/"+id, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		mockUserService.AssertCalled(t, "RevokeSession", user, id)
+	})
+}
+
+func TestConfirmEmailChangeController(t *testing.T) {
+	mockResp := &models.AuthServiceResponse{
+		Status:     "fail",
+		StatusCode: http.StatusForbidden,
+		Message:    "invalid or expired token",
+		Err:        errors.New("invalid or expired token"),
+	}
+
+	mockUserService.On("ConfirmEmailChange", "expired-token", mock.Anything).Return(mockResp)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/auth/confirm-email/expired-token", nil)
+
+	assert.NoError(t, err)
+
+	server.ServeHTTP(w, req)
+
+	respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, respBody, w.Body.Bytes())
+}
+
+func TestDataExportController(t *testing.T) {
+	exportRouteController.ExportRoute(router, mockUserService)
+	config, _ := config.LoadConfig(".")
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+	session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+	accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+	assert.NoError(t, err)
+
+	mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+	mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+
+	t.Run("request export", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusAccepted,
+			Message:    "Your data export is being prepared. You will receive an email with a download link once it is ready",
+		}
+
+		mockExportService.On("RequestExport", user, models.DataExportFormatZIP, mock.Anything).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/users/me/export?format=zip", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": mockResp.Status, "message": mockResp.Message})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("request export with an unknown format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/users/me/export?format=csv", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("request export too often", func(t *testing.T) {
+		request := func() int {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/users/me/export?format=zip", nil)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			server.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusAccepted, request())
+		assert.Equal(t, http.StatusTooManyRequests, request())
+	})
+
+	t.Run("download export", func(t *testing.T) {
+		export := &models.DataExport{ID: primitive.NewObjectID(), Format: models.DataExportFormatJSON, Data: []byte(`{"profile":{}}`)}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Data:       export,
+		}
+
+		mockExportService.On("DownloadExport", "download-token").Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/users/exports/download-token", nil)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=data-export.json", w.Header().Get("Content-Disposition"))
+		assert.Equal(t, export.Data, w.Body.Bytes())
+	})
+}
+
+func TestVerifyMFAController(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		challenge := &models.MFAChallengeInput{
+			MFAToken: "challenge",
+			Code:     "123456",
+		}
+		mockResp := &models.AuthServiceResponse{
+			Status:             "success",
+			StatusCode:         http.StatusOK,
+			AccessToken:        "access",
+			RefreshAccessToken: "refresh",
+		}
+
+		mockAuthService.On("VerifyMFA", challenge, mock.Anything).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{
+			"mfaToken": challenge.MFAToken,
+			"code":     challenge.Code,
+		})
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/login/mfa", bytes.NewBuffer(reqBody))
+
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status":        mockResp.Status,
+			"access_token":  mockResp.AccessToken,
+			"refresh_token": mockResp.RefreshAccessToken,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		assert.Contains(t, strings.Join(w.Header().Values("Set-Cookie"), "\n"), "access_token="+mockResp.AccessToken)
+
+		mockAuthService.AssertExpectations(t)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		challenge := &models.MFAChallengeInput{
+			MFAToken: "challenge",
+			Code:     "000000",
+		}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "fail",
+			StatusCode: http.StatusUnauthorized,
+			Message:    "invalid two factor code",
+			Err:        errors.New("invalid two factor code"),
+		}
+
+		mockAuthService.On("VerifyMFA", challenge, mock.Anything).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{
+			"mfaToken": challenge.MFAToken,
+			"code":     challenge.Code,
+		})
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/login/mfa", bytes.NewBuffer(reqBody))
+
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status":  mockResp.Status,
+			"message": mockResp.Message,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		assert.Empty(t, w.Header().Values("Set-Cookie"))
+	})
+}
+
+func TestWebAuthnLoginController(t *testing.T) {
+	webAuthnRoute.WebAuthnRoute(router, mockUserService)
+
+	assertion := &models.WebAuthnAssertionInput{
+		ID:   "credential",
+		Type: "public-key",
+		Response: models.WebAuthnAssertionResponse{
+			ClientDataJSON:    "clientData",
+			AuthenticatorData: "authData",
+			Signature:         "signature",
+		},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:             "success",
+			StatusCode:         http.StatusOK,
+			AccessToken:        "access",
+			RefreshAccessToken: "refresh",
+		}
+
+		mockWebAuthnService.On("FinishLogin", assertion, mock.Anything).Return(mockResp).Once()
+
+		reqBody, err := json.Marshal(assertion)
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/webauthn/login", bytes.NewBuffer(reqBody))
+
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status":        mockResp.Status,
+			"access_token":  mockResp.AccessToken,
+			"refresh_token": mockResp.RefreshAccessToken,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+
+		cookies := strings.Join(w.Header().Values("Set-Cookie"), "\n")
+		assert.Contains(t, cookies, "access_token="+mockResp.AccessToken)
+		assert.Contains(t, cookies, "refresh_token="+mockResp.RefreshAccessToken)
+		assert.Contains(t, cookies, "logged_in=true")
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:     "fail",
+			StatusCode: http.StatusUnauthorized,
+			Message:    "invalid assertion signature",
+			Err:        errors.New("invalid assertion signature"),
+		}
+
+		mockWebAuthnService.On("FinishLogin", assertion, mock.Anything).Return(mockResp).Once()
+
+		reqBody, err := json.Marshal(assertion)
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/webauthn/login", bytes.NewBuffer(reqBody))
+
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Values("Set-Cookie"))
+	})
+
+	t.Run("login options without email", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Data:       models.WebAuthnRequestOptions{Challenge: "challenge"},
+		}
+
+		mockWebAuthnService.On("BeginLogin", (*models.WebAuthnLoginOptionsInput)(nil)).Return(mockResp).Once()
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/webauthn/login/options", nil)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "\"challenge\":\"challenge\"")
+	})
+}
+
+func TestMagicLinkController(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Message:    "You will receive a sign in link if user with that email exist",
+		}
+
+		mockAuthService.On("RequestMagicLink", "bochuang@gmail.com").Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{"email": "bochuang@gmail.com"})
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/magic-link", bytes.NewBuffer(reqBody))
+
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/json")
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{
+			"status":  mockResp.Status,
+			"message": mockResp.Message,
+		})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("throttled per address", func(t *testing.T) {
+		mockAuthService.On("RequestMagicLink", "linked@gmail.com").Return(&models.AuthServiceResponse{Status: "success", StatusCode: http.StatusOK})
+
+		request := func(ip string) int {
+			reqBody, err := json.Marshal(gin.H{"email": "linked@gmail.com"})
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/auth/magic-link", bytes.NewBuffer(reqBody))
+			assert.NoError(t, err)
+			req.RemoteAddr = ip + ":1234"
+
+			server.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		for i := 1; i <= 5; i++ {
+			assert.Equal(t, http.StatusOK, request(fmt.Sprintf("10.3.0.%d", i)))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, request("10.3.0.6"))
+	})
+
+	t.Run("sign in", func(t *testing.T) {
+		mockResp := &models.AuthServiceResponse{
+			Status:             "success",
+			StatusCode:         http.StatusOK,
+			AccessToken:        "access",
+			RefreshAccessToken: "refresh",
+		}
+
+		mockAuthService.On("SignInWithMagicLink", "link-token", mock.Anything).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/magic-link/link-token", nil)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, strings.Join(w.Header().Values("Set-Cookie"), "\n"), "access_token="+mockResp.AccessToken)
+		assert.Contains(t, strings.Join(w.Header().Values("Set-Cookie"), "\n"), "refresh_token="+mockResp.RefreshAccessToken)
+	})
+}
+
+// loginAs returns an access token for user and lets DeserializeUser find the
+// user and the session of the token.
+func loginAs(t *testing.T, user *models.DBResponse) string {
+	config, _ := config.LoadConfig(".")
+	session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+	accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, user.ID, map[string]interface{}{"sid": session.ID.Hex()}, config.AccessTokenPrivateKey)
+	assert.NoError(t, err)
+
+	mockUserService.On("FindUserById", user.ID.Hex()).Return(user, nil)
+	mockUserService.On("FindSessionById", session.ID.Hex()).Return(session, nil)
+
+	return accessToken
+}
+
+func TestAdminController(t *testing.T) {
+	adminRouteController.AdminRoute(router, mockUserService)
+
+	admin := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleAdmin, Verified: true}
+	adminToken := loginAs(t, admin)
+
+	t.Run("list users", func(t *testing.T) {
+		query := &models.UserListQuery{Email: "bo", Page: 1, Limit: 20}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Data:       models.UserListResponse{Users: []models.UserResponse{}, Total: 0, Page: 1, Limit: 20},
+		}
+
+		mockAdminService.On("ListUsers", query).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/users?email=bo", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": "success", "data": mockResp.Data})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("invalid pagination", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/users?limit=1000", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("change role", func(t *testing.T) {
+		id := primitive.NewObjectID().Hex()
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Message:    "User role updated",
+		}
+
+		mockAdminService.On("UpdateUserRole", admin, id, models.RoleAdmin).Return(mockResp)
+
+		reqBody, err := json.Marshal(gin.H{"role": models.RoleAdmin})
+
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/api/admin/users/"+id+"/role", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockAdminService.AssertCalled(t, "UpdateUserRole", admin, id, models.RoleAdmin)
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		query := &models.AuditEventQuery{Type: models.AuditLogin, Page: 1, Limit: 20}
+		mockResp := &models.AuthServiceResponse{
+			Status:     "success",
+			StatusCode: http.StatusOK,
+			Data:       models.AuditEventListResponse{Events: []*models.AuditEvent{}, Total: 0, Page: 1, Limit: 20},
+		}
+
+		mockAdminService.On("ListAuditEvents", query).Return(mockResp)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/audit?type=login", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": "success", "data": mockResp.Data})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+	})
+
+	t.Run("forbidden for users", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Role: models.RoleUser, Verified: true}
+		userToken := loginAs(t, user)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodDelete, "/api/admin/users/"+admin.ID.Hex(), nil)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+
+		assert.NoError(t, err)
+
+		server.ServeHTTP(w, req)
+
+		respBody, err := json.Marshal(gin.H{"status": "fail", "message": "You do not have permission to perform this action"})
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, respBody, w.Body.Bytes())
+		mockAdminService.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+	})
+}
+
+func TestKeyController(t *testing.T) {
+	keyRouteController.KeyRoute(&server.RouterGroup)
+
+	jwks := &models.JWKS{Keys: []models.JWK{{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: "k1", N: "sXch", E: "AQAB"}}}
+	mockKeyService.On("JWKS").Return(&models.AuthServiceResponse{Status: "success", StatusCode: http.StatusOK, Data: jwks})
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+
+	server.ServeHTTP(w, req)
+
+	respBody, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, string(respBody), w.Body.String())
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/mocks"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDataExport(t *testing.T) {
+	ctx := context.TODO()
+	temp := template.Must(template.ParseGlob("../templates/*.html"))
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockAuditRepository := new(mocks.MockAuditRepository)
+	mockDataExportRepository := new(mocks.MockDataExportRepository)
+	mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.Anything).Return(nil)
+	es := services.NewExportService(mockSessionRepository, mockWebAuthnRepository, mockAuditRepository, mockDataExportRepository, ctx, temp)
+
+	user := &models.DBResponse{
+		ID:              primitive.NewObjectID(),
+		Name:            "Bo Chuang",
+		Email:           "bochuang@gmail.com",
+		Password:        "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK",
+		TwoFactorSecret: "secret",
+		RecoveryCodes:   []string{"recovery"},
+	}
+
+	mockSessionRepository.On("FindAllUserSessions", mock.Anything, user.ID).Return([]*models.Session{{ID: primitive.NewObjectID(), UserID: user.ID, Device: "Chrome on macOS"}}, nil)
+	mockAuditRepository.On("FindUserAuditEvents", mock.Anything, user.ID).Return([]*models.AuditEvent{{ID: primitive.NewObjectID(), Type: models.AuditLogin, ActorID: user.ID}}, nil)
+	mockWebAuthnRepository.On("FindUserWebAuthnCredentials", mock.Anything, user.ID).Return([]*models.WebAuthnCredential{{ID: primitive.NewObjectID(), UserID: user.ID, Name: "Laptop", PublicKey: []byte("public-key")}}, nil)
+
+	var stored []*models.DataExport
+	mockDataExportRepository.On("CreateDataExport", mock.Anything, mock.AnythingOfType("*models.DataExport")).Run(func(args mock.Arguments) {
+		stored = append(stored, args.Get(1).(*models.DataExport))
+	}).Return("download-token", nil)
+
+	t.Run("JSON archive", func(t *testing.T) {
+		// Sending the email fails without an SMTP server, the export is
+		// stored before that.
+		es.BuildExport(user, models.DataExportFormatJSON)
+
+		export := stored[len(stored)-1]
+		assert.Equal(t, user.ID, export.UserID)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), export.ExpiresAt, 5*time.Second)
+
+		var archive models.UserDataExport
+		assert.NoError(t, json.Unmarshal(export.Data, &archive))
+		assert.Equal(t, user.Email, archive.Profile.Email)
+		assert.Len(t, archive.Sessions, 1)
+		assert.Len(t, archive.AuditEvents, 1)
+		assert.Len(t, archive.Passkeys, 1)
+
+		assert.NotContains(t, string(export.Data), user.Password)
+		assert.NotContains(t, string(export.Data), "secret")
+		assert.NotContains(t, string(export.Data), "recovery")
+	})
+
+	t.Run("ZIP archive", func(t *testing.T) {
+		es.BuildExport(user, models.DataExportFormatZIP)
+
+		export := stored[len(stored)-1]
+		assert.Equal(t, models.DataExportFormatZIP, export.Format)
+
+		reader, err := zip.NewReader(bytes.NewReader(export.Data), int64(len(export.Data)))
+		assert.NoError(t, err)
+		assert.Len(t, reader.File, 1)
+		assert.Equal(t, "data-export.json", reader.File[0].Name)
+
+		file, err := reader.File[0].Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(file)
+		assert.NoError(t, err)
+
+		var archive models.UserDataExport
+		assert.NoError(t, json.Unmarshal(data, &archive))
+		assert.Equal(t, user.Email, archive.Profile.Email)
+	})
+
+	t.Run("Request is accepted", func(t *testing.T) {
+		other := &models.DBResponse{ID: primitive.NewObjectID(), Email: "other@gmail.com"}
+		mockSessionRepository.On("FindAllUserSessions", mock.Anything, other.ID).Return(nil, errors.New("connection refused"))
+
+		response := es.RequestExport(other, models.DataExportFormatJSON, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		response := es.RequestExport(user, "csv", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		export := &models.DataExport{ID: primitive.NewObjectID(), Format: models.DataExportFormatJSON, Data: []byte("{}")}
+		mockDataExportRepository.On("FindDataExportByToken", mock.Anything, "download-token").Return(export, nil)
+
+		response := es.DownloadExport("download-token")
+		assert.NoError(t, response.Err)
+		assert.Equal(t, export, response.Data)
+	})
+
+	t.Run("Expired link", func(t *testing.T) {
+		mockDataExportRepository.On("FindDataExportByToken", mock.Anything, "expired-token").Return(nil, mongo.ErrNoDocuments)
+
+		response := es.DownloadExport("expired-token")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
@@ -0,0 +1,220 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tonybobo/auth-template/middleware"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func serveAs(user *models.DBResponse, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	engine := gin.New()
+	setUser := func(ctx *gin.Context) {
+		if user != nil {
+			ctx.Set("currentUser", user)
+		}
+	}
+	handlers = append([]gin.HandlerFunc{setUser}, handlers...)
+	handlers = append(handlers, func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+	engine.GET("/", handlers...)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	engine.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRequireRole(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		w := serveAs(&models.DBResponse{Role: models.RoleAdmin}, middleware.RequireRole(models.RoleAdmin))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		w := serveAs(&models.DBResponse{Role: models.RoleUser}, middleware.RequireRole(models.RoleAdmin))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, `{"message":"You do not have permission to perform this action","status":"fail"}`, w.Body.String())
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		w := serveAs(nil, middleware.RequireRole(models.RoleAdmin))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestRequirePermission(t *testing.T) {
+	t.Run("admin has every permission", func(t *testing.T) {
+		w := serveAs(&models.DBResponse{Role: models.RoleAdmin}, middleware.RequirePermission(models.PermissionUsersRead, models.PermissionUsersDelete))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("user is forbidden", func(t *testing.T) {
+		w := serveAs(&models.DBResponse{Role: models.RoleUser}, middleware.RequirePermission(models.PermissionUsersRead))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("parse mapping", func(t *testing.T) {
+		rp, err := models.ParseRolePermissions("admin=*; support=users:read, users:write ;user=")
+
+		assert.NoError(t, err)
+		assert.True(t, rp.Allows("admin", models.PermissionUsersDelete))
+		assert.True(t, rp.Allows("support", models.PermissionUsersWrite))
+		assert.False(t, rp.Allows("support", models.PermissionUsersDelete))
+		assert.False(t, rp.Allows("user", models.PermissionUsersRead))
+		assert.False(t, rp.Allows("unknown", models.PermissionUsersRead))
+
+		_, err = models.ParseRolePermissions("support")
+		assert.Error(t, err)
+	})
+
+	t.Run("covers", func(t *testing.T) {
+		rp, err := models.ParseRolePermissions("admin=*;support=users:read,users:write,roles:write;reader=users:read;user=")
+
+		assert.NoError(t, err)
+		assert.True(t, rp.Covers("admin", "support"))
+		assert.True(t, rp.Covers("support", "reader"))
+		assert.True(t, rp.Covers("support", "user"))
+		assert.False(t, rp.Covers("support", "admin"))
+		assert.False(t, rp.Covers("reader", "support"))
+	})
+}
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (bool, time.Duration, error) {
+	return false, 0, errors.New("backend unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	policy := models.RateLimitPolicy{Limit: 2, Period: time.Minute}
+	engine := gin.New()
+	engine.SetTrustedProxies([]string{"10.1.0.1"})
+	engine.POST("/login", middleware.RateLimit(utils.NewMemoryRateLimiter(), models.RateLimitLogin, policy, false), func(ctx *gin.Context) {
+		var input models.SignInInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": "fail"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+
+	postVia := func(ip, forwardedFor, email string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`","password":"12345678"}`))
+		req.RemoteAddr = ip + ":1234"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	post := func(ip, email string) *httptest.ResponseRecorder {
+		return postVia(ip, "", email)
+	}
+
+	t.Run("keyed by ip", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, post("10.0.0.1", "a@gmail.com").Code)
+		assert.Equal(t, http.StatusOK, post("10.0.0.1", "b@gmail.com").Code)
+
+		w := post("10.0.0.1", "c@gmail.com")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("keyed by email", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, post("10.0.0.2", "target@gmail.com").Code)
+		assert.Equal(t, http.StatusOK, post("10.0.0.3", "Target@gmail.com").Code)
+
+		w := post("10.0.0.4", "target@gmail.com")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("forged forwarded for", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, postVia("10.0.0.5", "192.168.0.1", "d@gmail.com").Code)
+		assert.Equal(t, http.StatusOK, postVia("10.0.0.5", "192.168.0.2", "e@gmail.com").Code)
+
+		w := postVia("10.0.0.5", "192.168.0.3", "f@gmail.com")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("forwarded for from a trusted proxy", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, postVia("10.1.0.1", "192.168.1.1", "g@gmail.com").Code)
+		assert.Equal(t, http.StatusOK, postVia("10.1.0.1", "192.168.1.1", "h@gmail.com").Code)
+		assert.Equal(t, http.StatusOK, postVia("10.1.0.1", "192.168.1.2", "i@gmail.com").Code)
+
+		w := postVia("10.1.0.1", "192.168.1.1", "j@gmail.com")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("keyed by user", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID()}
+		engine := gin.New()
+		engine.POST("/export", func(ctx *gin.Context) {
+			ctx.Set("currentUser", user)
+		}, middleware.RateLimit(utils.NewMemoryRateLimiter(), models.RateLimitDataExport, policy, false), func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+		})
+
+		serve := func(ip string) int {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/export", nil)
+			req.RemoteAddr = ip + ":1234"
+			engine.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusOK, serve("10.0.1.1"))
+		assert.Equal(t, http.StatusOK, serve("10.0.1.2"))
+		assert.Equal(t, http.StatusTooManyRequests, serve("10.0.1.3"))
+	})
+
+	t.Run("backend failure", func(t *testing.T) {
+		serve := func(failOpen bool) int {
+			engine := gin.New()
+			engine.POST("/login", middleware.RateLimit(failingRateLimiter{}, models.RateLimitLogin, policy, failOpen), func(ctx *gin.Context) {
+				ctx.JSON(http.StatusOK, gin.H{"status": "success"})
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"a@gmail.com"}`))
+			engine.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusServiceUnavailable, serve(false))
+		assert.Equal(t, http.StatusOK, serve(true))
+	})
+
+	t.Run("parse policies", func(t *testing.T) {
+		policies, err := models.ParseRateLimitPolicies("login=3/30s; register = 1/1h")
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.RateLimitPolicy{Limit: 3, Period: 30 * time.Second}, policies[models.RateLimitLogin])
+		assert.Equal(t, models.RateLimitPolicy{Limit: 1, Period: time.Hour}, policies[models.RateLimitRegister])
+		assert.Equal(t, models.DefaultRateLimitPolicies[models.RateLimitVerifyEmail], policies[models.RateLimitVerifyEmail])
+
+		_, err = models.ParseRateLimitPolicies("login=0/1m")
+		assert.Error(t, err)
+		_, err = models.ParseRateLimitPolicies("login=5")
+		assert.Error(t, err)
+	})
+}
@@ -6,19 +6,22 @@ import (
 	"html/template"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/config"
 	"github.com/tonybobo/auth-template/mocks"
 	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/repository"
 	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestRefreshAccessToken(t *testing.T) {
-	mockAuthRepository := new(mocks.MockAuthRepository)
-	ctx := context.TODO()
-	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewUserServiceImpl(mockAuthRepository, ctx, temp)
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newUserService()
 
 	t.Run("expired token", func(t *testing.T) {
 
@@ -29,20 +32,453 @@ func TestRefreshAccessToken(t *testing.T) {
 			StatusCode: http.StatusForbidden,
 		}
 
-		response := us.RefreshAccessToken(cookie)
+		response := us.RefreshAccessToken(cookie, models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.Equal(t, mockResponse.Status, response.Status)
 		assert.Equal(t, mockResponse.StatusCode, response.StatusCode)
 
 	})
 
+	t.Run("rotate refresh token", func(t *testing.T) {
+		config, _ := config.LoadConfig(".")
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Verified: true}
+		stored := &models.RefreshToken{ID: primitive.NewObjectID(), UserID: user.ID, Family: primitive.NewObjectID()}
+
+		cookie, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, user.ID, map[string]interface{}{"jti": stored.ID.Hex()}, config.RefreshTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockRefreshTokenRepository.On("FindRefreshTokenById", mock.Anything, stored.ID).Return(stored, nil)
+		mockSessionRepository.On("FindSessionById", mock.Anything, stored.Family).Return(&models.Session{ID: stored.Family, UserID: user.ID}, nil)
+		mockSessionRepository.On("TouchSession", mock.Anything, stored.Family, mock.AnythingOfType("time.Time"), models.ClientInfo{}).Return(nil)
+		mockRefreshTokenRepository.On("MarkRefreshTokenUsed", mock.Anything, stored.ID).Return(nil)
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(token *models.RefreshToken) bool {
+			return token.Family == stored.Family && token.UserID == user.ID
+		})).Return(nil)
+
+		response := us.RefreshAccessToken(cookie, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NotEmpty(t, response.AccessToken)
+		assert.NotEmpty(t, response.RefreshAccessToken)
+		assert.NotEqual(t, cookie, response.RefreshAccessToken)
+		mockRefreshTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("reused refresh token revokes family", func(t *testing.T) {
+		config, _ := config.LoadConfig(".")
+		userId := primitive.NewObjectID()
+		stored := &models.RefreshToken{ID: primitive.NewObjectID(), UserID: userId, Family: primitive.NewObjectID(), Used: true}
+
+		cookie, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, userId, map[string]interface{}{"jti": stored.ID.Hex()}, config.RefreshTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockRefreshTokenRepository.On("FindRefreshTokenById", mock.Anything, stored.ID).Return(stored, nil)
+		mockSessionRepository.On("RevokeSession", mock.Anything, stored.Family).Return(nil)
+		mockRefreshTokenRepository.On("RevokeRefreshTokenFamily", mock.Anything, stored.Family).Return(nil)
+
+		response := us.RefreshAccessToken(cookie, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, "refresh token reuse detected", response.Message)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, stored.Family)
+		mockSessionRepository.AssertCalled(t, "RevokeSession", mock.Anything, stored.Family)
+		mockRefreshTokenRepository.AssertNotCalled(t, "MarkRefreshTokenUsed", mock.Anything, stored.ID)
+	})
+
+	t.Run("concurrently used refresh token revokes family", func(t *testing.T) {
+		config, _ := config.LoadConfig(".")
+		userId := primitive.NewObjectID()
+		stored := &models.RefreshToken{ID: primitive.NewObjectID(), UserID: userId, Family: primitive.NewObjectID()}
+
+		cookie, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, userId, map[string]interface{}{"jti": stored.ID.Hex()}, config.RefreshTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockRefreshTokenRepository.On("FindRefreshTokenById", mock.Anything, stored.ID).Return(stored, nil)
+		mockSessionRepository.On("FindSessionById", mock.Anything, stored.Family).Return(&models.Session{ID: stored.Family, UserID: userId}, nil)
+		mockRefreshTokenRepository.On("MarkRefreshTokenUsed", mock.Anything, stored.ID).Return(repository.ErrRefreshTokenUsed)
+		mockSessionRepository.On("RevokeSession", mock.Anything, stored.Family).Return(nil)
+		mockRefreshTokenRepository.On("RevokeRefreshTokenFamily", mock.Anything, stored.Family).Return(nil)
+
+		response := us.RefreshAccessToken(cookie, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, "refresh token reuse detected", response.Message)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, stored.Family)
+	})
+
+	t.Run("revoked refresh token", func(t *testing.T) {
+		config, _ := config.LoadConfig(".")
+		userId := primitive.NewObjectID()
+		stored := &models.RefreshToken{ID: primitive.NewObjectID(), UserID: userId, Family: primitive.NewObjectID(), Revoked: true}
+
+		cookie, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, userId, map[string]interface{}{"jti": stored.ID.Hex()}, config.RefreshTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockRefreshTokenRepository.On("FindRefreshTokenById", mock.Anything, stored.ID).Return(stored, nil)
+
+		response := us.RefreshAccessToken(cookie, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	})
+
 }
 
-func TestVerifyEmail(t *testing.T) {
+func TestLogout(t *testing.T) {
+	us, _, mockRefreshTokenRepository, mockSessionRepository, _ := newUserService()
+
+	t.Run("revoke current session", func(t *testing.T) {
+		sessionId := primitive.NewObjectID()
+
+		mockSessionRepository.On("RevokeSession", mock.Anything, sessionId).Return(nil)
+		mockRefreshTokenRepository.On("RevokeRefreshTokenFamily", mock.Anything, sessionId).Return(nil)
+
+		response := us.Logout(sessionId.Hex())
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockSessionRepository.AssertExpectations(t)
+		mockRefreshTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("revoke every session", func(t *testing.T) {
+		userId := primitive.NewObjectID()
+
+		mockSessionRepository.On("RevokeUserSessions", mock.Anything, userId).Return(nil)
+		mockRefreshTokenRepository.On("RevokeUserRefreshTokens", mock.Anything, userId).Return(nil)
+
+		response := us.LogoutEverywhere(userId.Hex())
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockSessionRepository.AssertExpectations(t)
+		mockRefreshTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("invalid session id", func(t *testing.T) {
+		response := us.Logout("invalid")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("revoke the session of a refresh token", func(t *testing.T) {
+		config, _ := config.LoadConfig(".")
+		stored := &models.RefreshToken{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Family: primitive.NewObjectID()}
+
+		cookie, err := utils.CreateTokenWithClaims(config.RefreshTokenExpiresIn, stored.UserID, map[string]interface{}{"jti": stored.ID.Hex()}, config.RefreshTokenPrivateKey)
+		assert.NoError(t, err)
+
+		mockRefreshTokenRepository.On("FindRefreshTokenById", mock.Anything, stored.ID).Return(stored, nil).Once()
+		mockSessionRepository.On("RevokeSession", mock.Anything, stored.Family).Return(nil).Once()
+		mockRefreshTokenRepository.On("RevokeRefreshTokenFamily", mock.Anything, stored.Family).Return(nil).Once()
+
+		response := us.LogoutRefreshToken(cookie)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, stored.Family)
+	})
+
+	t.Run("invalid refresh token", func(t *testing.T) {
+		response := us.LogoutRefreshToken("not-a-token")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	us, _, mockRefreshTokenRepository, mockSessionRepository, _ := newUserService()
+
+	user := &models.DBResponse{ID: primitive.NewObjectID()}
+
+	t.Run("list sessions", func(t *testing.T) {
+		current := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID, Device: "Chrome on macOS", IP: "10.0.0.1"}
+		other := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID, Device: "Safari on iOS", IP: "10.0.0.2"}
+
+		mockSessionRepository.On("FindUserSessions", mock.Anything, user.ID).Return([]*models.Session{current, other}, nil)
+
+		response := us.ListSessions(user, current.ID)
+		assert.NoError(t, response.Err)
+
+		sessions := response.Data.([]models.SessionResponse)
+		assert.Len(t, sessions, 2)
+		assert.True(t, sessions[0].Current)
+		assert.Equal(t, "Chrome on macOS", sessions[0].Device)
+		assert.False(t, sessions[1].Current)
+		assert.Equal(t, "10.0.0.2", sessions[1].IP)
+	})
+
+	t.Run("revoke own session", func(t *testing.T) {
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+
+		mockSessionRepository.On("FindSessionById", mock.Anything, session.ID).Return(session, nil)
+		mockSessionRepository.On("RevokeSession", mock.Anything, session.ID).Return(nil)
+		mockRefreshTokenRepository.On("RevokeRefreshTokenFamily", mock.Anything, session.ID).Return(nil)
+
+		response := us.RevokeSession(user, session.ID.Hex())
+		assert.NoError(t, response.Err)
+		mockSessionRepository.AssertCalled(t, "RevokeSession", mock.Anything, session.ID)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, session.ID)
+	})
+
+	t.Run("session of another user", func(t *testing.T) {
+		session := &models.Session{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+
+		mockSessionRepository.On("FindSessionById", mock.Anything, session.ID).Return(session, nil)
+
+		response := us.RevokeSession(user, session.ID.Hex())
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		mockSessionRepository.AssertNotCalled(t, "RevokeSession", mock.Anything, session.ID)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		response := us.RevokeSession(user, "invalid")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newUserService()
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com", Password: "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"}
+	sessionId := primitive.NewObjectID()
+
+	t.Run("Success", func(t *testing.T) {
+		mockAuthRepository.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(hash string) bool {
+			return utils.VerifyPassword(hash, "new-password") == nil
+		})).Return(nil)
+		mockSessionRepository.On("RevokeOtherSessions", mock.Anything, user.ID, sessionId).Return(nil)
+		mockRefreshTokenRepository.On("RevokeOtherRefreshTokens", mock.Anything, user.ID, sessionId).Return(nil)
+
+		input := &models.ChangePasswordInput{CurrentPassword: "12345678", Password: "new-password", PasswordConfirm: "new-password"}
+		response := us.ChangePassword(user, sessionId, input, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockSessionRepository.AssertCalled(t, "RevokeOtherSessions", mock.Anything, user.ID, sessionId)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeOtherRefreshTokens", mock.Anything, user.ID, sessionId)
+	})
+
+	t.Run("Wrong current password", func(t *testing.T) {
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(1, nil).Once()
+
+		input := &models.ChangePasswordInput{CurrentPassword: "wrong-password", Password: "other-password", PasswordConfirm: "other-password"}
+		response := us.ChangePassword(user, sessionId, input, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.Equal(t, "current password is incorrect", response.Message)
+		mockAuthRepository.AssertCalled(t, "RecordFailedLogin", mock.Anything, user.ID)
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+
+	t.Run("Too many wrong current passwords lock the account", func(t *testing.T) {
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(5, nil).Once()
+		mockAuthRepository.On("LockUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		input := &models.ChangePasswordInput{CurrentPassword: "wrong-password", Password: "other-password", PasswordConfirm: "other-password"}
+		response := us.ChangePassword(user, sessionId, input, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "LockUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time"))
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+
+	t.Run("Locked account", func(t *testing.T) {
+		locked := *user
+		locked.LockedUntil = time.Now().Add(time.Minute)
+
+		input := &models.ChangePasswordInput{CurrentPassword: "12345678", Password: "other-password", PasswordConfirm: "other-password"}
+		response := us.ChangePassword(&locked, sessionId, input, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+		mockAuthRepository.AssertNumberOfCalls(t, "RecordFailedLogin", 2)
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+
+	t.Run("Password breaks the policy", func(t *testing.T) {
+		input := &models.ChangePasswordInput{CurrentPassword: "12345678", Password: "bochuang", PasswordConfirm: "bochuang"}
+		response := us.ChangePassword(user, sessionId, input, models.ClientInfo{})
+
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.Equal(t, []string{"password must not contain your email", "password must not contain your name"}, response.Data)
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+
+	t.Run("Password does not match", func(t *testing.T) {
+		input := &models.ChangePasswordInput{CurrentPassword: "12345678", Password: "other-password", PasswordConfirm: "another-password"}
+		response := us.ChangePassword(user, sessionId, input, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newUserService()
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com"}
+
+	t.Run("Update name", func(t *testing.T) {
+		name := "  Tony Bo  "
+		mockAuthRepository.On("UpdateOne", mock.Anything, user.ID, "name", "Tony Bo").Return(&models.DBResponse{ID: user.ID, Name: "Tony Bo", Email: user.Email}, nil)
+
+		response := us.UpdateProfile(user, &models.UpdateProfileInput{Name: &name})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "Tony Bo", response.User.Name)
+	})
+
+	t.Run("Empty name", func(t *testing.T) {
+		name := "   "
+
+		response := us.UpdateProfile(user, &models.UpdateProfileInput{Name: &name})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertNumberOfCalls(t, "UpdateOne", 1)
+	})
+
+	t.Run("Same email", func(t *testing.T) {
+		email := "BoChuang@gmail.com"
+
+		response := us.UpdateProfile(user, &models.UpdateProfileInput{Email: &email})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "RequestEmailChange", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Email already used", func(t *testing.T) {
+		email := "taken@gmail.com"
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, email).Return(&models.DBResponse{ID: primitive.NewObjectID(), Email: email}, nil)
+
+		response := us.UpdateProfile(user, &models.UpdateProfileInput{Email: &email})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "RequestEmailChange", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	us, mockAuthRepository, _, _, mockAuditRepository := newUserService()
+
+	t.Run("Success", func(t *testing.T) {
+		mockAuthRepository.On("ConfirmEmailChange", mock.Anything, "valid-token").Return(&models.DBResponse{ID: primitive.NewObjectID(), Email: "new@gmail.com"}, nil)
+
+		response := us.ConfirmEmailChange("valid-token", models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockAuditRepository.AssertCalled(t, "CreateAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+			return event.Type == models.AuditChangeEmail && event.Outcome == models.AuditSuccess && event.Email == "new@gmail.com"
+		}))
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		mockAuthRepository.On("ConfirmEmailChange", mock.Anything, "invalid-token").Return(nil, errors.New("invalid or expired token"))
+
+		response := us.ConfirmEmailChange("invalid-token", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	})
+
+	t.Run("Email taken meanwhile", func(t *testing.T) {
+		mockAuthRepository.On("ConfirmEmailChange", mock.Anything, "taken-token").Return(nil, errors.New("user with that email already exist"))
+
+		response := us.ConfirmEmailChange("taken-token", models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	us, mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, _ := newUserService()
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com", Password: "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"}
+
+	t.Run("Success", func(t *testing.T) {
+		mockAuthRepository.On("ScheduleUserDeletion", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil)
+		mockSessionRepository.On("RevokeUserSessions", mock.Anything, user.ID).Return(nil)
+		mockRefreshTokenRepository.On("RevokeUserRefreshTokens", mock.Anything, user.ID).Return(nil)
+
+		response := us.DeleteAccount(user, &models.DeleteAccountInput{Password: "12345678"}, models.ClientInfo{})
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		deleteAt := mockAuthRepository.Calls[len(mockAuthRepository.Calls)-1].Arguments.Get(2).(time.Time)
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), deleteAt, 5*time.Second)
+		mockSessionRepository.AssertCalled(t, "RevokeUserSessions", mock.Anything, user.ID)
+		mockRefreshTokenRepository.AssertCalled(t, "RevokeUserRefreshTokens", mock.Anything, user.ID)
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(1, nil).Once()
+
+		response := us.DeleteAccount(user, &models.DeleteAccountInput{Password: "wrong-password"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "RecordFailedLogin", mock.Anything, user.ID)
+		mockAuthRepository.AssertNumberOfCalls(t, "ScheduleUserDeletion", 1)
+	})
+
+	t.Run("Too many wrong passwords lock the account", func(t *testing.T) {
+		mockAuthRepository.On("RecordFailedLogin", mock.Anything, user.ID).Return(5, nil).Once()
+		mockAuthRepository.On("LockUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		response := us.DeleteAccount(user, &models.DeleteAccountInput{Password: "wrong-password"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "LockUser", mock.Anything, user.ID, mock.AnythingOfType("time.Time"))
+		mockAuthRepository.AssertNumberOfCalls(t, "ScheduleUserDeletion", 1)
+	})
+
+	t.Run("Locked account", func(t *testing.T) {
+		locked := *user
+		locked.LockedUntil = time.Now().Add(time.Minute)
+
+		response := us.DeleteAccount(&locked, &models.DeleteAccountInput{Password: "12345678"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusLocked, response.StatusCode)
+		mockAuthRepository.AssertNumberOfCalls(t, "RecordFailedLogin", 2)
+		mockAuthRepository.AssertNumberOfCalls(t, "ScheduleUserDeletion", 1)
+	})
+}
+
+func TestAccountDeletionWorker(t *testing.T) {
 	mockAuthRepository := new(mocks.MockAuthRepository)
 	ctx := context.TODO()
-	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewUserServiceImpl(mockAuthRepository, ctx, temp)
+	mockRefreshTokenRepository := new(mocks.MockRefreshTokenRepository)
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockAuditRepository := new(mocks.MockAuditRepository)
+	mockDataExportRepository := new(mocks.MockDataExportRepository)
+	worker := services.NewAccountDeletionWorker(mockAuthRepository, mockRefreshTokenRepository, mockSessionRepository, mockWebAuthnRepository, mockAuditRepository, mockDataExportRepository, ctx)
+
+	due := &models.DBResponse{ID: primitive.NewObjectID(), Email: "gone@gmail.com"}
+	cancelled := &models.DBResponse{ID: primitive.NewObjectID(), Email: "back@gmail.com"}
+	failing := &models.DBResponse{ID: primitive.NewObjectID(), Email: "retry@gmail.com"}
+
+	mockAuthRepository.On("FindUsersDueForDeletion", mock.Anything, mock.AnythingOfType("time.Time"), int64(100)).Return([]*models.DBResponse{due, cancelled, failing}, nil)
+	mockAuthRepository.On("MarkUserPurging", mock.Anything, due.ID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockAuthRepository.On("MarkUserPurging", mock.Anything, cancelled.ID, mock.AnythingOfType("time.Time")).Return(mongo.ErrNoDocuments)
+	mockAuthRepository.On("MarkUserPurging", mock.Anything, failing.ID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockAuthRepository.On("DeleteScheduledUser", mock.Anything, due.ID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockSessionRepository.On("DeleteUserSessions", mock.Anything, mock.Anything).Return(nil)
+	mockRefreshTokenRepository.On("DeleteUserRefreshTokens", mock.Anything, mock.Anything).Return(nil)
+	mockWebAuthnRepository.On("DeleteUserWebAuthnCredentials", mock.Anything, due.ID).Return(nil)
+	mockWebAuthnRepository.On("DeleteUserWebAuthnCredentials", mock.Anything, failing.ID).Return(errors.New("connection reset"))
+	mockDataExportRepository.On("DeleteUserDataExports", mock.Anything, due.ID).Return(nil)
+	mockAuditRepository.On("AnonymizeAuditEvents", mock.Anything, due.ID, due.Email).Return(nil)
+
+	deleted, err := worker.PurgeDueAccounts()
+	assert.Error(t, err)
+	assert.Equal(t, 1, deleted)
+	mockAuditRepository.AssertCalled(t, "AnonymizeAuditEvents", mock.Anything, due.ID, due.Email)
+	mockDataExportRepository.AssertCalled(t, "DeleteUserDataExports", mock.Anything, due.ID)
+	mockAuthRepository.AssertCalled(t, "DeleteScheduledUser", mock.Anything, due.ID, mock.Anything)
+	mockSessionRepository.AssertNotCalled(t, "DeleteUserSessions", mock.Anything, cancelled.ID)
+	mockWebAuthnRepository.AssertNotCalled(t, "DeleteUserWebAuthnCredentials", mock.Anything, cancelled.ID)
+	// The failed user is kept, so the next run purges it again.
+	mockAuthRepository.AssertNotCalled(t, "DeleteScheduledUser", mock.Anything, failing.ID, mock.Anything)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newUserService()
 
 	t.Run("Success", func(t *testing.T) {
 
@@ -55,9 +491,9 @@ func TestVerifyEmail(t *testing.T) {
 			mock.AnythingOfType("*context.emptyCtx"),
 			"asdasdasddaa",
 		}
-		mockAuthRepository.On("VerifyEmail", mockArg...).Return(nil)
+		mockAuthRepository.On("VerifyEmail", mockArg...).Return(&models.DBResponse{ID: primitive.NewObjectID()}, nil)
 
-		response := us.VerifyEmail("asdasdasddaa")
+		response := us.VerifyEmail("asdasdasddaa", models.ClientInfo{})
 		assert.NoError(t, response.Err)
 		assert.ObjectsAreEqualValues(mockResponse, response)
 	})
@@ -74,9 +510,9 @@ func TestVerifyEmail(t *testing.T) {
 			mock.AnythingOfType("*context.emptyCtx"),
 			"12345678",
 		}
-		mockAuthRepository.On("VerifyEmail", mockArg...).Return(errors.New("invalid email"))
+		mockAuthRepository.On("VerifyEmail", mockArg...).Return(nil, errors.New("invalid email"))
 
-		response := us.VerifyEmail("12345678")
+		response := us.VerifyEmail("12345678", models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.ObjectsAreEqualValues(mockResponse, response)
 	})
@@ -91,9 +527,9 @@ func TestVerifyEmail(t *testing.T) {
 			mock.AnythingOfType("*context.emptyCtx"),
 			"22345678",
 		}
-		mockAuthRepository.On("VerifyEmail", mockArg...).Return(errors.New("db error"))
+		mockAuthRepository.On("VerifyEmail", mockArg...).Return(nil, errors.New("db error"))
 
-		response := us.VerifyEmail("22345678")
+		response := us.VerifyEmail("22345678", models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.Equal(t, mockResponse.Status, response.Status)
 		assert.Equal(t, mockResponse.StatusCode, response.StatusCode)
@@ -102,10 +538,7 @@ func TestVerifyEmail(t *testing.T) {
 }
 
 func TestResetPassword(t *testing.T) {
-	mockAuthRepository := new(mocks.MockAuthRepository)
-	ctx := context.TODO()
-	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewUserServiceImpl(mockAuthRepository, ctx, temp)
+	us, mockAuthRepository, _, _, _ := newUserService()
 
 	t.Run("Success", func(t *testing.T) {
 		mockUserInput := &models.ResetPasswordInput{
@@ -121,11 +554,12 @@ func TestResetPassword(t *testing.T) {
 		mockArg := mock.Arguments{
 			mock.AnythingOfType("*context.emptyCtx"),
 			"YXNkYXNzZGFzZGFkYXNkYXM=",
-			mockUserInput.Password,
+			hashOf(mockUserInput.Password),
 		}
-		mockAuthRepository.On("ClearResetPasswordToken", mockArg...).Return(nil)
+		mockAuthRepository.On("FindUserByResetToken", mock.Anything, "YXNkYXNzZGFzZGFkYXNkYXM=").Return(&models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com"}, nil).Once()
+		mockAuthRepository.On("ClearResetPasswordToken", mockArg...).Return(&models.DBResponse{ID: primitive.NewObjectID()}, nil)
 
-		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM=")
+		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM=", models.ClientInfo{})
 		assert.NoError(t, response.Err)
 		assert.ObjectsAreEqualValues(mockResponse, response)
 	})
@@ -145,11 +579,12 @@ func TestResetPassword(t *testing.T) {
 		mockArg := mock.Arguments{
 			mock.AnythingOfType("*context.emptyCtx"),
 			"YXNkYXNzZGFzZGFkYXNkYXM=",
-			mockUserInput.Password,
+			hashOf(mockUserInput.Password),
 		}
-		mockAuthRepository.On("ClearResetPasswordToken", mockArg...).Return(errors.New("invalid or expired token"))
+		mockAuthRepository.On("FindUserByResetToken", mock.Anything, "YXNkYXNzZGFzZGFkYXNkYXM=").Return(nil, errors.New("invalid or expired token"))
+		mockAuthRepository.On("ClearResetPasswordToken", mockArg...).Return(nil, errors.New("invalid or expired token"))
 
-		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM=")
+		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM=", models.ClientInfo{})
 
 		assert.ObjectsAreEqualValues(mockResponse, response)
 	})
@@ -171,7 +606,7 @@ func TestResetPassword(t *testing.T) {
 			mockUserInput.Password,
 		}
 
-		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM")
+		response := us.ResetPassword(mockUserInput, "YXNkYXNzZGFzZGFkYXNkYXM", models.ClientInfo{})
 
 		assert.ObjectsAreEqualValues(mockResponse, response)
 		mockAuthRepository.AssertNotCalled(t, "ClearResetPasswordToken", mockArg...)
@@ -179,11 +614,73 @@ func TestResetPassword(t *testing.T) {
 
 }
 
-func TestForgetPassword(t *testing.T) {
-	mockAuthRepository := new(mocks.MockAuthRepository)
-	ctx := context.TODO()
+// newAuthService returns an auth service backed by mocked repositories. Audit
+// events are accepted unless a test expects a particular one.
+func newAuthService() (services.AuthService, *mocks.MockAuthRepository, *mocks.MockRefreshTokenRepository, *mocks.MockSessionRepository, *mocks.MockAuditRepository) {
+	authRepository, refreshTokenRepository, sessionRepository, auditRepository := newServiceRepositories()
+	temp := template.Must(template.ParseGlob("../templates/*.html"))
+
+	return services.NewAuthService(authRepository, refreshTokenRepository, sessionRepository, auditRepository, context.TODO(), temp), authRepository, refreshTokenRepository, sessionRepository, auditRepository
+}
+
+// newUserService returns a user service backed by mocked repositories, like
+// newAuthService.
+func newUserService() (services.UserService, *mocks.MockAuthRepository, *mocks.MockRefreshTokenRepository, *mocks.MockSessionRepository, *mocks.MockAuditRepository) {
+	authRepository, refreshTokenRepository, sessionRepository, auditRepository := newServiceRepositories()
 	temp := template.Must(template.ParseGlob("../templates/*.html"))
-	us := services.NewUserServiceImpl(mockAuthRepository, ctx, temp)
+
+	return services.NewUserServiceImpl(authRepository, refreshTokenRepository, sessionRepository, auditRepository, context.TODO(), temp), authRepository, refreshTokenRepository, sessionRepository, auditRepository
+}
+
+func newServiceRepositories() (*mocks.MockAuthRepository, *mocks.MockRefreshTokenRepository, *mocks.MockSessionRepository, *mocks.MockAuditRepository) {
+	auditRepository := new(mocks.MockAuditRepository)
+	auditRepository.On("CreateAuditEvent", mock.Anything, mock.Anything).Return(nil)
+
+	return new(mocks.MockAuthRepository), new(mocks.MockRefreshTokenRepository), new(mocks.MockSessionRepository), auditRepository
+}
+
+// acceptPasswordUpgrades lets sign ins with the bcrypt fixtures succeed, they
+// are upgraded to argon2id on every successful sign in.
+func acceptPasswordUpgrades(mockAuthRepository *mocks.MockAuthRepository) {
+	mockAuthRepository.On("UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+}
+
+// hashOf matches a password hash made from password.
+func hashOf(password string) interface{} {
+	return mock.MatchedBy(func(hash string) bool {
+		return utils.VerifyPassword(hash, password) == nil
+	})
+}
+
+func TestResetPasswordPolicy(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newUserService()
+
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com"}
+	mockAuthRepository.On("FindUserByResetToken", mock.Anything, "reset-token").Return(user, nil)
+
+	t.Run("Rejected password keeps the token", func(t *testing.T) {
+		input := &models.ResetPasswordInput{Password: "chuang2023", PasswordConfirm: "chuang2023"}
+		response := us.ResetPassword(input, "reset-token", models.ClientInfo{})
+
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.Equal(t, "password must not contain your name", response.Message)
+		mockAuthRepository.AssertNotCalled(t, "ClearResetPasswordToken", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		input := &models.ResetPasswordInput{Password: "correct horse", PasswordConfirm: "correct horse"}
+		mockAuthRepository.On("ClearResetPasswordToken", mock.Anything, "reset-token", hashOf(input.Password)).Return(user, nil)
+
+		response := us.ResetPassword(input, "reset-token", models.ClientInfo{})
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockAuthRepository.AssertExpectations(t)
+	})
+}
+
+func TestForgetPassword(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newUserService()
 
 	t.Run("Success", func(t *testing.T) {
 		email := "bochuang@gmail.com"
@@ -209,7 +706,7 @@ func TestForgetPassword(t *testing.T) {
 
 		mockAuthRepository.On("ForgetPassword", mockArgs1...).Return(mockUserResp, resetToken, nil)
 
-		response := us.ForgetPassword(email)
+		response := us.ForgetPassword(email, models.ClientInfo{})
 		assert.NoError(t, response.Err)
 		assert.ObjectsAreEqual(mockResponse, response)
 	})
@@ -238,8 +735,116 @@ func TestForgetPassword(t *testing.T) {
 
 		mockAuthRepository.On("ForgetPassword", mockArgs1...).Return(mockUserResp, resetToken, nil)
 
-		response := us.ForgetPassword(email)
+		response := us.ForgetPassword(email, models.ClientInfo{})
 		assert.Error(t, response.Err)
 		assert.ObjectsAreEqual(mockResponse, response)
 	})
 }
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	us, mockAuthRepository, _, _, _ := newUserService()
+
+	config, _ := config.LoadConfig(".")
+
+	t.Run("Enroll", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "bochuang@gmail.com"}
+
+		mockAuthRepository.On("SetTwoFactorSecret", mock.Anything, user.ID, mock.AnythingOfType("string")).Return(nil)
+
+		response := us.EnrollTwoFactor(user)
+		assert.NoError(t, response.Err)
+
+		enrollment := response.Data.(models.TwoFactorEnrollment)
+		assert.NotEmpty(t, enrollment.Secret)
+		assert.Contains(t, enrollment.URL, "otpauth://totp/")
+
+		stored := mockAuthRepository.Calls[len(mockAuthRepository.Calls)-1].Arguments.String(2)
+		decrypted, err := utils.Decrypt(stored, config.TwoFactorEncryptionKey)
+		assert.NoError(t, err)
+		assert.Equal(t, enrollment.Secret, decrypted)
+	})
+
+	t.Run("Already enabled", func(t *testing.T) {
+		user := &models.DBResponse{ID: primitive.NewObjectID(), TwoFactorEnabled: true}
+
+		response := us.EnrollTwoFactor(user)
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+	})
+
+	t.Run("Confirm with valid code", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), TwoFactorSecret: encryptedSecret}
+		code, _ := utils.TOTPCode(secret, time.Now())
+
+		mockAuthRepository.On("SetRecoveryCodes", mock.Anything, user.ID, mock.AnythingOfType("[]string")).Return(nil)
+		mockAuthRepository.On("EnableTwoFactor", mock.Anything, user.ID).Return(nil)
+
+		mockAuthRepository.On("UseTOTPCounter", mock.Anything, user.ID, mock.Anything).Return(nil)
+
+		response := us.ConfirmTwoFactor(user, code)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		mockAuthRepository.AssertCalled(t, "EnableTwoFactor", mock.Anything, user.ID)
+
+		codes := response.Data.(models.RecoveryCodesResponse).RecoveryCodes
+		assert.Len(t, codes, 10)
+	})
+
+	t.Run("Confirm with invalid code", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), TwoFactorSecret: encryptedSecret}
+
+		response := us.ConfirmTwoFactor(user, "abcdef")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "EnableTwoFactor", mock.Anything, user.ID)
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), TwoFactorEnabled: true, TwoFactorSecret: encryptedSecret}
+		code, _ := utils.TOTPCode(secret, time.Now())
+
+		mockAuthRepository.On("DisableTwoFactor", mock.Anything, user.ID).Return(nil)
+
+		mockAuthRepository.On("UseTOTPCounter", mock.Anything, user.ID, mock.Anything).Return(nil)
+
+		response := us.DisableTwoFactor(user, code)
+		assert.NoError(t, response.Err)
+		mockAuthRepository.AssertCalled(t, "DisableTwoFactor", mock.Anything, user.ID)
+	})
+
+	t.Run("Regenerate recovery codes", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), Email: "bochuang@gmail.com", TwoFactorEnabled: true, TwoFactorSecret: encryptedSecret}
+		code, _ := utils.TOTPCode(secret, time.Now())
+
+		mockAuthRepository.On("SetRecoveryCodes", mock.Anything, user.ID, mock.AnythingOfType("[]string")).Return(nil)
+
+		mockAuthRepository.On("UseTOTPCounter", mock.Anything, user.ID, mock.Anything).Return(nil)
+
+		response := us.RegenerateRecoveryCodes(user, code)
+		assert.NoError(t, response.Err)
+
+		codes := response.Data.(models.RecoveryCodesResponse).RecoveryCodes
+		stored := mockAuthRepository.Calls[len(mockAuthRepository.Calls)-1].Arguments.Get(2).([]string)
+		assert.Len(t, stored, len(codes))
+		assert.NoError(t, utils.VerifyPassword(stored[0], codes[0]))
+	})
+
+	t.Run("Regenerate recovery codes with invalid code", func(t *testing.T) {
+		secret, _ := utils.GenerateTOTPSecret()
+		encryptedSecret, _ := utils.Encrypt(secret, config.TwoFactorEncryptionKey)
+		user := &models.DBResponse{ID: primitive.NewObjectID(), TwoFactorEnabled: true, TwoFactorSecret: encryptedSecret}
+
+		response := us.RegenerateRecoveryCodes(user, "abcdef")
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		mockAuthRepository.AssertNotCalled(t, "SetRecoveryCodes", mock.Anything, user.ID, mock.Anything)
+	})
+}
@@ -0,0 +1,465 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/utils"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B test secret "12345678901234567890" in base32.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	t.Run("RFC 6238 vectors", func(t *testing.T) {
+		vectors := map[int64]string{
+			59:          "287082",
+			1111111109:  "081804",
+			1111111111:  "050471",
+			1234567890:  "005924",
+			2000000000:  "279037",
+			20000000000: "353130",
+		}
+
+		for unix, expected := range vectors {
+			code, err := utils.TOTPCode(secret, time.Unix(unix, 0))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, code)
+		}
+	})
+
+	t.Run("accepts adjacent period", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+		code, err := utils.TOTPCode(secret, now.Add(-30*time.Second))
+		assert.NoError(t, err)
+
+		assert.True(t, utils.ValidateTOTP(secret, code, now))
+		assert.False(t, utils.ValidateTOTP(secret, code, now.Add(90*time.Second)))
+		assert.False(t, utils.ValidateTOTP(secret, "12345", now))
+	})
+
+	t.Run("rejects used time steps", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+		code, err := utils.TOTPCode(secret, now.Add(-30*time.Second))
+		assert.NoError(t, err)
+
+		counter, valid := utils.MatchTOTP(secret, code, now, 0)
+		assert.True(t, valid)
+		assert.Equal(t, now.Unix()/30-1, counter)
+
+		_, valid = utils.MatchTOTP(secret, code, now, counter)
+		assert.False(t, valid)
+		_, valid = utils.MatchTOTP(secret, code, now, counter-1)
+		assert.True(t, valid)
+	})
+
+	t.Run("generated secret", func(t *testing.T) {
+		secret, err := utils.GenerateTOTPSecret()
+		assert.NoError(t, err)
+
+		code, err := utils.TOTPCode(secret, time.Now())
+		assert.NoError(t, err)
+		assert.True(t, utils.ValidateTOTP(secret, code, time.Now()))
+	})
+}
+
+func TestEncrypt(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	t.Run("round trip", func(t *testing.T) {
+		encrypted, err := utils.Encrypt("secret", key)
+		assert.NoError(t, err)
+		assert.NotEqual(t, "secret", encrypted)
+
+		decrypted, err := utils.Decrypt(encrypted, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", decrypted)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		encrypted, err := utils.Encrypt("secret", key)
+		assert.NoError(t, err)
+
+		otherKey := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+		_, err = utils.Decrypt(encrypted, otherKey)
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateEmailOTP(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		code, err := utils.GenerateEmailOTP(6)
+		assert.NoError(t, err)
+		assert.Regexp(t, "^[0-9]{6}$", code)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash, err := utils.HashToken("verification-code")
+	assert.NoError(t, err)
+
+	again, _ := utils.HashToken("verification-code")
+	other, _ := utils.HashToken("other-code")
+
+	assert.Equal(t, hash, again)
+	assert.NotEqual(t, hash, other)
+	assert.Regexp(t, "^hmac-sha256:[0-9a-f]{64}$", hash)
+	assert.NotContains(t, hash, utils.Encode("verification-code"))
+
+	_, err = base64.StdEncoding.DecodeString(hash)
+	assert.Error(t, err)
+}
+
+func encodeRSAKey(t *testing.T, key *rsa.PrivateKey, public bool) string {
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(block))
+}
+
+func TestKeyRing(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	keys := "k1:" + encodeRSAKey(t, key1, false) + ",k2:" + encodeRSAKey(t, key2, false)
+
+	oldRing, err := utils.ParseKeyRing(keys, "")
+	assert.NoError(t, err)
+	ring, err := utils.ParseKeyRing(keys, "k2")
+	assert.NoError(t, err)
+
+	t.Run("Signs with the signing key", func(t *testing.T) {
+		assert.Equal(t, "k1", oldRing.SigningKey().ID)
+
+		sessionClaims := utils.NewTokenClaims(time.Minute, "user-id", utils.TokenOptions{})
+		sessionClaims.SessionID = "session-id"
+
+		token, err := utils.CreateToken(sessionClaims, ring)
+		assert.NoError(t, err)
+
+		header, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		assert.Contains(t, string(header), `"kid":"k2"`)
+
+		claims, err := utils.ValidateToken(token, ring)
+		assert.NoError(t, err)
+		assert.Equal(t, "user-id", claims.Subject)
+		assert.Equal(t, "session-id", claims.SessionID)
+	})
+
+	t.Run("Tokens of the previous signing key stay valid", func(t *testing.T) {
+		token, err := utils.CreateToken(utils.NewTokenClaims(time.Minute, "user-id", utils.TokenOptions{}), oldRing)
+		assert.NoError(t, err)
+
+		_, err = utils.ValidateToken(token, ring)
+		assert.NoError(t, err)
+
+		withoutOld, err := utils.ParseKeyRing("k2:"+encodeRSAKey(t, key2, false), "k2")
+		assert.NoError(t, err)
+		_, err = utils.ValidateToken(token, withoutOld)
+		assert.EqualError(t, err, `unknown key id "k1"`)
+	})
+
+	t.Run("Token signed with another key under a known kid", func(t *testing.T) {
+		forged, err := utils.ParseKeyRing("k2:"+encodeRSAKey(t, key1, false), "k2")
+		assert.NoError(t, err)
+
+		token, err := utils.CreateToken(utils.NewTokenClaims(time.Minute, "user-id", utils.TokenOptions{}), forged)
+		assert.NoError(t, err)
+
+		_, err = utils.ValidateToken(token, ring)
+		assert.Error(t, err)
+	})
+
+	t.Run("Tokens without kid are tried against every key", func(t *testing.T) {
+		token, err := utils.CreateTokenWithClaims(time.Minute, "user-id", nil, encodeRSAKey(t, key1, false))
+		assert.NoError(t, err)
+
+		claims, err := utils.ValidateToken(token, ring)
+		assert.NoError(t, err)
+		assert.Equal(t, "user-id", claims.Subject)
+	})
+
+	t.Run("Verify only keys", func(t *testing.T) {
+		ring, err := utils.ParseKeyRing("old:"+encodeRSAKey(t, key1, true)+",new:"+encodeRSAKey(t, key2, false), "new")
+		assert.NoError(t, err)
+		assert.Nil(t, ring.Keys()[0].PrivateKey)
+
+		_, err = utils.ParseKeyRing("old:"+encodeRSAKey(t, key1, true), "old")
+		assert.EqualError(t, err, `signing key "old" has no private key`)
+
+		_, err = utils.ParseKeyRing(keys, "k3")
+		assert.EqualError(t, err, `signing key "k3" is not in the key ring`)
+
+		_, err = utils.ParseKeyRing(keys+",k1:"+encodeRSAKey(t, key1, true), "k1")
+		assert.EqualError(t, err, `key id "k1" is listed twice`)
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		jwks := ring.JWKS()
+		assert.Len(t, jwks.Keys, 2)
+
+		jwk := jwks.Keys[1]
+		assert.Equal(t, models.JWK{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: "k2", N: jwk.N, E: "AQAB"}, jwk)
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		assert.NoError(t, err)
+		assert.Equal(t, key2.PublicKey.N, new(big.Int).SetBytes(n))
+	})
+
+	t.Run("RFC 7638 thumbprint", func(t *testing.T) {
+		n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+		assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", utils.KeyThumbprint(key))
+	})
+
+	t.Run("Falls back to ACCESS_TOKEN_PRIVATE_KEY", func(t *testing.T) {
+		ring, err := utils.LoadAccessTokenKeyRing()
+		assert.NoError(t, err)
+		assert.Len(t, ring.Keys(), 1)
+		assert.Equal(t, utils.KeyThumbprint(ring.SigningKey().PublicKey), ring.SigningKey().ID)
+	})
+
+	t.Run("Loaded once", func(t *testing.T) {
+		first, err := utils.LoadAccessTokenKeyRing()
+		assert.NoError(t, err)
+
+		second, err := utils.LoadAccessTokenKeyRing()
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+}
+
+func TestPasswordHasher(t *testing.T) {
+	bcryptHash := "$2a$10$AxVZoSa4XI1XdTbvElmm2eNHsBm7KST02qTmGboWYOleB4NOv11PK"
+
+	t.Run("argon2id is the default", func(t *testing.T) {
+		hash, err := utils.HashPassword("12345678")
+		assert.NoError(t, err)
+		assert.Regexp(t, `^\$argon2id\$v=19\$m=65536,t=3,p=4\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, hash)
+
+		assert.NoError(t, utils.VerifyPassword(hash, "12345678"))
+		assert.ErrorIs(t, utils.VerifyPassword(hash, "12345679"), utils.ErrPasswordMismatch)
+		assert.False(t, utils.PasswordNeedsRehash(hash))
+	})
+
+	t.Run("bcrypt hashes are still verified", func(t *testing.T) {
+		assert.NoError(t, utils.VerifyPassword(bcryptHash, "12345678"))
+		assert.ErrorIs(t, utils.VerifyPassword(bcryptHash, "12345679"), utils.ErrPasswordMismatch)
+		assert.True(t, utils.PasswordNeedsRehash(bcryptHash))
+	})
+
+	t.Run("Weaker parameters need a rehash", func(t *testing.T) {
+		weak, err := utils.NewArgon2idHasher(16*1024, 2, 1).Hash("12345678")
+		assert.NoError(t, err)
+		assert.NoError(t, utils.VerifyPassword(weak, "12345678"))
+		assert.True(t, utils.PasswordNeedsRehash(weak))
+
+		hasher := utils.NewBcryptHasher(12)
+		assert.True(t, hasher.NeedsRehash(bcryptHash))
+		assert.False(t, utils.NewBcryptHasher(10).NeedsRehash(bcryptHash))
+	})
+
+	t.Run("Unknown hash", func(t *testing.T) {
+		assert.ErrorIs(t, utils.VerifyPassword("plain-text", "plain-text"), utils.ErrUnknownPasswordHash)
+		assert.ErrorIs(t, utils.VerifyPassword("$argon2id$v=19$m=1,t=1$bad", "12345678"), utils.ErrUnknownPasswordHash)
+	})
+}
+
+func TestPasswordPepper(t *testing.T) {
+	argon2id := utils.NewArgon2idHasher(16*1024, 2, 1)
+	v1 := utils.NewPepperedHasher(argon2id, "1", []byte("first-pepper"))
+	v2 := utils.NewPepperedHasher(argon2id, "2", []byte("second-pepper"))
+
+	t.Run("Version is kept with the hash", func(t *testing.T) {
+		hash, err := v2.Hash("12345678")
+		assert.NoError(t, err)
+		assert.Regexp(t, `^\$pepper\$2\$argon2id\$v=19\$`, hash)
+
+		assert.True(t, v2.Supports(hash))
+		assert.NoError(t, v2.Verify(hash, "12345678"))
+		assert.ErrorIs(t, v2.Verify(hash, "12345679"), utils.ErrPasswordMismatch)
+	})
+
+	t.Run("Rotated pepper is not supported by the new version", func(t *testing.T) {
+		hash, _ := v1.Hash("12345678")
+		assert.False(t, v2.Supports(hash))
+		assert.NoError(t, v1.Verify(hash, "12345678"))
+
+		plain, _ := argon2id.Hash("12345678")
+		assert.False(t, v1.Supports(plain))
+	})
+
+	t.Run("Pepper is needed to verify", func(t *testing.T) {
+		hash, _ := v1.Hash("12345678")
+		other := utils.NewPepperedHasher(argon2id, "1", []byte("wrong-pepper"))
+		assert.ErrorIs(t, other.Verify(hash, "12345678"), utils.ErrPasswordMismatch)
+
+		// The test config has no PASSWORD_PEPPERS.
+		assert.ErrorIs(t, utils.VerifyPassword(hash, "12345678"), utils.ErrUnknownPepper)
+	})
+
+	t.Run("Parse peppers", func(t *testing.T) {
+		peppers, err := utils.ParsePasswordPeppers(" 1:first-pepper , 2:second:pepper ")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"1": []byte("first-pepper"), "2": []byte("second:pepper")}, peppers)
+
+		_, err = utils.ParsePasswordPeppers("1:first,1:again")
+		assert.EqualError(t, err, `pepper version "1" is listed twice`)
+
+		_, err = utils.ParsePasswordPeppers("1")
+		assert.Error(t, err)
+
+		_, err = utils.ParsePasswordPeppers("a$b:secret")
+		assert.Error(t, err)
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := &models.PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Denylist:      []string{"Password123!"},
+	}
+
+	t.Run("Valid password", func(t *testing.T) {
+		violations, err := policy.Validate("Tr0ub4dor&3x", "bochuang@gmail.com", "Bo Chuang")
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("One message per rule", func(t *testing.T) {
+		violations, err := policy.Validate("abc", "bochuang@gmail.com", "Bo Chuang")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"password must be at least 10 characters long",
+			"password must contain an uppercase letter",
+			"password must contain a digit",
+			"password must contain a symbol",
+		}, violations)
+	})
+
+	t.Run("Denylist ignores case", func(t *testing.T) {
+		violations, _ := policy.Validate("PASSWORD123!", "bochuang@gmail.com", "Bo Chuang")
+		assert.Equal(t, []string{"password must contain a lowercase letter", "password is too common"}, violations)
+	})
+
+	t.Run("Similar to email and name", func(t *testing.T) {
+		violations, _ := policy.Validate("Bochuang#2023", "bochuang@gmail.com", "Tony Bo")
+		assert.Equal(t, []string{"password must not contain your email"}, violations)
+
+		violations, _ = policy.Validate("MyTony#2023x", "bochuang@gmail.com", "Tony Bo")
+		assert.Equal(t, []string{"password must not contain your name"}, violations)
+	})
+
+	t.Run("Maximum length", func(t *testing.T) {
+		violations, _ := (&models.PasswordPolicy{}).Validate(string(make([]byte, 73)), "", "")
+		assert.Equal(t, []string{"password must not be longer than 72 bytes"}, violations)
+	})
+
+	t.Run("Breached password file", func(t *testing.T) {
+		// SHA-1 of "password" and "12345678".
+		path := filepath.Join(t.TempDir(), "pwned.txt")
+		content := "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n7c222fb2927d828af22f592134e8932480637c0d\n"
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+		breached, err := utils.NewBreachedPasswordFile(path)
+		assert.NoError(t, err)
+
+		suffixes, err := breached.Range("5baa6")
+		assert.NoError(t, err)
+		assert.Equal(t, 9545824, suffixes["1E4C9B93F3F0682250B6CF8331B7EE68FD8"])
+
+		policy := &models.PasswordPolicy{Breached: breached}
+
+		violations, err := policy.Validate("12345678", "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"password has appeared in a data breach"}, violations)
+
+		violations, err = policy.Validate("correct horse", "", "")
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("Large breached password file", func(t *testing.T) {
+		var hashes []string
+		for i := 0; i < 2000; i++ {
+			sum := sha1.Sum([]byte(fmt.Sprintf("password%d", i)))
+			hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+		}
+		sort.Strings(hashes)
+
+		var content strings.Builder
+		for i, hash := range hashes {
+			fmt.Fprintf(&content, "%s:%d\r\n", hash, i+1)
+		}
+
+		path := filepath.Join(t.TempDir(), "pwned.txt")
+		assert.NoError(t, os.WriteFile(path, []byte(content.String()), 0600))
+
+		breached, err := utils.NewBreachedPasswordFile(path)
+		assert.NoError(t, err)
+
+		for _, i := range []int{0, 1, 999, 1998, 1999} {
+			suffixes, err := breached.Range(hashes[i][:5])
+			assert.NoError(t, err)
+			assert.Equal(t, i+1, suffixes[hashes[i][5:]])
+		}
+
+		suffixes, err := breached.Range("00000")
+		assert.NoError(t, err)
+		assert.Empty(t, suffixes)
+
+		suffixes, err = breached.Range("FFFFF")
+		assert.NoError(t, err)
+		assert.Empty(t, suffixes)
+	})
+
+	t.Run("Invalid breached password file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pwned.txt")
+		assert.NoError(t, os.WriteFile(path, []byte("not-a-hash:1\n"), 0600))
+
+		_, err := utils.NewBreachedPasswordFile(path)
+		assert.EqualError(t, err, `invalid breached password entry "not-a-hash:1"`)
+	})
+}
+
+func TestDescribeDevice(t *testing.T) {
+	userAgents := map[string]string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36":                   "Chrome on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46":       "Edge on Windows",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0":                                                                  "Firefox on Linux",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36":                            "Chrome on Android",
+		"curl/8.4.0": "curl",
+		"":           "Unknown",
+	}
+
+	for userAgent, device := range userAgents {
+		assert.Equal(t, device, utils.DescribeDevice(userAgent), userAgent)
+	}
+}
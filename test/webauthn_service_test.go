@@ -0,0 +1,276 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/mocks"
+	"github.com/tonybobo/auth-template/models"
+	"github.com/tonybobo/auth-template/services"
+	"github.com/tonybobo/auth-template/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// softwareAuthenticator plays the part of a platform authenticator with an
+// ES256 key, so the ceremonies can be tested without a browser.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+}
+
+func newSoftwareAuthenticator(t *testing.T, rpID, origin string) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	credentialId := make([]byte, 16)
+	_, err = rand.Read(credentialId)
+	assert.NoError(t, err)
+
+	return &softwareAuthenticator{key: key, credentialId: credentialId, rpID: rpID, origin: origin}
+}
+
+func (a *softwareAuthenticator) cosePublicKey(t *testing.T) []byte {
+	key, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	assert.NoError(t, err)
+
+	return key
+}
+
+func (a *softwareAuthenticator) authenticatorData(t *testing.T, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.rpID))
+	flags := utils.WebAuthnFlagUserPresent | utils.WebAuthnFlagUserVerified
+
+	if attested {
+		flags |= utils.WebAuthnFlagAttestedData
+	}
+
+	data := append([]byte{}, rpIdHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+		data = append(data, a.credentialId...)
+		data = append(data, a.cosePublicKey(t)...)
+	}
+
+	return data
+}
+
+func (a *softwareAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	clientData, err := json.Marshal(utils.ClientData{Type: ceremonyType, Challenge: challenge, Origin: a.origin})
+	assert.NoError(t, err)
+
+	return clientData
+}
+
+func (a *softwareAuthenticator) register(t *testing.T, challenge string) *models.WebAuthnRegistrationInput {
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(t, true),
+	})
+	assert.NoError(t, err)
+
+	return &models.WebAuthnRegistrationInput{
+		ID:   utils.EncodeWebAuthn(a.credentialId),
+		Type: "public-key",
+		Name: "laptop",
+		Response: models.WebAuthnAttestationResponse{
+			ClientDataJSON:    utils.EncodeWebAuthn(a.clientData(t, "webauthn.create", challenge)),
+			AttestationObject: utils.EncodeWebAuthn(attestationObject),
+		},
+	}
+}
+
+func (a *softwareAuthenticator) assert(t *testing.T, challenge string, userId primitive.ObjectID) *models.WebAuthnAssertionInput {
+	a.signCount++
+
+	authData := a.authenticatorData(t, false)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	assert.NoError(t, err)
+
+	return &models.WebAuthnAssertionInput{
+		ID:   utils.EncodeWebAuthn(a.credentialId),
+		Type: "public-key",
+		Response: models.WebAuthnAssertionResponse{
+			ClientDataJSON:    utils.EncodeWebAuthn(clientData),
+			AuthenticatorData: utils.EncodeWebAuthn(authData),
+			Signature:         utils.EncodeWebAuthn(signature),
+			UserHandle:        utils.EncodeWebAuthn(userId[:]),
+		},
+	}
+}
+
+func TestWebAuthn(t *testing.T) {
+	mockAuthRepository := new(mocks.MockAuthRepository)
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockRefreshTokenRepository := new(mocks.MockRefreshTokenRepository)
+	mockSessionRepository := new(mocks.MockSessionRepository)
+	mockAuditRepository := new(mocks.MockAuditRepository)
+	mockAuditRepository.On("CreateAuditEvent", mock.Anything, mock.Anything).Return(nil)
+	ws := services.NewWebAuthnService(mockAuthRepository, mockWebAuthnRepository, mockRefreshTokenRepository, mockSessionRepository, mockAuditRepository, context.TODO())
+
+	config, _ := config.LoadConfig(".")
+	authenticator := newSoftwareAuthenticator(t, config.WebAuthnRPID, config.WebAuthnOrigin)
+	user := &models.DBResponse{ID: primitive.NewObjectID(), Name: "Bo Chuang", Email: "bochuang@gmail.com", Verified: true}
+
+	mockWebAuthnRepository.On("CreateWebAuthnChallenge", mock.Anything, mock.AnythingOfType("*models.WebAuthnChallenge")).Return(nil)
+
+	var credential *models.WebAuthnCredential
+
+	t.Run("Register", func(t *testing.T) {
+		mockWebAuthnRepository.On("FindUserWebAuthnCredentials", mock.Anything, user.ID).Return([]*models.WebAuthnCredential{}, nil)
+
+		response := ws.BeginRegistration(user)
+		assert.NoError(t, response.Err)
+
+		options := response.Data.(models.WebAuthnCreationOptions)
+		assert.Equal(t, config.WebAuthnRPID, options.RP.ID)
+		assert.Equal(t, utils.EncodeWebAuthn(user.ID[:]), options.User.ID)
+
+		mockWebAuthnRepository.On("ConsumeWebAuthnChallenge", mock.Anything, options.Challenge, "webauthn.create").Return(&models.WebAuthnChallenge{Challenge: options.Challenge, UserID: user.ID}, nil)
+		mockWebAuthnRepository.On("CreateWebAuthnCredential", mock.Anything, mock.AnythingOfType("*models.WebAuthnCredential")).Return(nil)
+
+		response = ws.FinishRegistration(user, authenticator.register(t, options.Challenge))
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+
+		credential = response.Data.(*models.WebAuthnCredential)
+		assert.Equal(t, authenticator.credentialId, credential.CredentialID)
+		assert.Equal(t, user.ID, credential.UserID)
+	})
+
+	t.Run("Register with wrong origin", func(t *testing.T) {
+		other := newSoftwareAuthenticator(t, config.WebAuthnRPID, "https://evil.example.com")
+
+		response := ws.FinishRegistration(user, other.register(t, "challenge"))
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		response := ws.BeginLogin(nil)
+		assert.NoError(t, response.Err)
+
+		options := response.Data.(models.WebAuthnRequestOptions)
+		assert.Empty(t, options.AllowCredentials)
+
+		mockWebAuthnRepository.On("ConsumeWebAuthnChallenge", mock.Anything, options.Challenge, "webauthn.get").Return(&models.WebAuthnChallenge{Challenge: options.Challenge}, nil)
+		mockWebAuthnRepository.On("FindWebAuthnCredentialById", mock.Anything, authenticator.credentialId).Return(credential, nil)
+		mockWebAuthnRepository.On("UpdateWebAuthnSignCount", mock.Anything, credential.ID, uint32(1)).Return(nil)
+		mockAuthRepository.On("FindUserById", mock.Anything, user.ID).Return(user, nil)
+		mockSessionRepository.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+		mockRefreshTokenRepository.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+		response = ws.FinishLogin(authenticator.assert(t, options.Challenge, user.ID), models.ClientInfo{IP: "10.0.0.1"})
+		assert.NoError(t, response.Err)
+		assert.NotEmpty(t, response.AccessToken)
+		assert.NotEmpty(t, response.RefreshAccessToken)
+
+		event := mockAuditRepository.Calls[len(mockAuditRepository.Calls)-1].Arguments.Get(1).(*models.AuditEvent)
+		assert.Equal(t, models.AuditLoginPasskey, event.Type)
+		assert.Equal(t, models.AuditSuccess, event.Outcome)
+		assert.Equal(t, user.ID, event.ActorID)
+		assert.Equal(t, "10.0.0.1", event.IP)
+	})
+
+	t.Run("Login options do not reveal accounts", func(t *testing.T) {
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, mock.MatchedBy(func(email string) bool { return strings.EqualFold(email, "nobody@gmail.com") })).Return(&models.DBResponse{}, mongo.ErrNoDocuments)
+		owner := &models.DBResponse{ID: primitive.NewObjectID(), Email: "owner@gmail.com"}
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, owner.Email).Return(owner, nil)
+		mockWebAuthnRepository.On("FindUserWebAuthnCredentials", mock.Anything, owner.ID).Return([]*models.WebAuthnCredential{credential}, nil)
+
+		unknown := ws.BeginLogin(&models.WebAuthnLoginOptionsInput{Email: "nobody@gmail.com"}).Data.(models.WebAuthnRequestOptions)
+		again := ws.BeginLogin(&models.WebAuthnLoginOptionsInput{Email: "Nobody@gmail.com"}).Data.(models.WebAuthnRequestOptions)
+		known := ws.BeginLogin(&models.WebAuthnLoginOptionsInput{Email: owner.Email}).Data.(models.WebAuthnRequestOptions)
+
+		assert.Len(t, unknown.AllowCredentials, 1)
+		assert.Equal(t, unknown.AllowCredentials, again.AllowCredentials)
+		assert.Len(t, known.AllowCredentials, 1)
+		assert.Equal(t, utils.EncodeWebAuthn(authenticator.credentialId), known.AllowCredentials[0].ID)
+		assert.NotEqual(t, known.AllowCredentials, unknown.AllowCredentials)
+	})
+
+	t.Run("Failed login is audited", func(t *testing.T) {
+		response := ws.FinishLogin(&models.WebAuthnAssertionInput{Type: "password"}, models.ClientInfo{})
+		assert.Error(t, response.Err)
+
+		event := mockAuditRepository.Calls[len(mockAuditRepository.Calls)-1].Arguments.Get(1).(*models.AuditEvent)
+		assert.Equal(t, models.AuditLoginPasskey, event.Type)
+		assert.Equal(t, models.AuditFailure, event.Outcome)
+	})
+
+	t.Run("Login with invalid signature", func(t *testing.T) {
+		credential.SignCount = 1
+
+		response := ws.BeginLogin(nil)
+		options := response.Data.(models.WebAuthnRequestOptions)
+
+		mockWebAuthnRepository.On("ConsumeWebAuthnChallenge", mock.Anything, options.Challenge, "webauthn.get").Return(&models.WebAuthnChallenge{Challenge: options.Challenge}, nil)
+
+		assertion := authenticator.assert(t, options.Challenge, user.ID)
+		assertion.Response.Signature = utils.EncodeWebAuthn([]byte("not a signature"))
+
+		response = ws.FinishLogin(assertion, models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+
+	t.Run("Login with cloned authenticator", func(t *testing.T) {
+		credential.SignCount = 10
+
+		response := ws.BeginLogin(nil)
+		options := response.Data.(models.WebAuthnRequestOptions)
+
+		mockWebAuthnRepository.On("ConsumeWebAuthnChallenge", mock.Anything, options.Challenge, "webauthn.get").Return(&models.WebAuthnChallenge{Challenge: options.Challenge}, nil)
+
+		response = ws.FinishLogin(authenticator.assert(t, options.Challenge, user.ID), models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+
+	t.Run("Login with another user's challenge", func(t *testing.T) {
+		credential.SignCount = 0
+
+		mockAuthRepository.On("FindUserByEmail", mock.Anything, "other@gmail.com").Return(&models.DBResponse{ID: primitive.NewObjectID()}, nil)
+		mockWebAuthnRepository.On("FindUserWebAuthnCredentials", mock.Anything, mock.Anything).Return([]*models.WebAuthnCredential{}, nil)
+
+		response := ws.BeginLogin(&models.WebAuthnLoginOptionsInput{Email: "other@gmail.com"})
+		options := response.Data.(models.WebAuthnRequestOptions)
+		stored := mockWebAuthnRepository.Calls[len(mockWebAuthnRepository.Calls)-1].Arguments.Get(1).(*models.WebAuthnChallenge)
+
+		mockWebAuthnRepository.On("ConsumeWebAuthnChallenge", mock.Anything, options.Challenge, "webauthn.get").Return(stored, nil)
+
+		response = ws.FinishLogin(authenticator.assert(t, options.Challenge, user.ID), models.ClientInfo{})
+		assert.Error(t, response.Err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/thanhpk/randstr"
+	"github.com/tonybobo/auth-template/config"
+)
+
+const defaultTokenLeeway = 30 * time.Second
+
+// Audience is the "aud" claim. RFC 7519 allows a single string or an array,
+// a single audience is written as a string.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("invalid audience")
+	}
+
+	*a = list
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TokenClaims are the claims of an access token. Role and Scope let other
+// services authorize the request without looking the user up, Scope lists
+// the permissions of the role separated by spaces.
+type TokenClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// NewTokenClaims sets the claims every access token has: a new "jti", the
+// issuer and audience of the options and the times.
+func NewTokenClaims(ttl time.Duration, subject string, options TokenOptions) *TokenClaims {
+	now := time.Now().UTC()
+
+	return &TokenClaims{
+		Subject:   subject,
+		Issuer:    options.Issuer,
+		Audience:  options.Audience,
+		ID:        randstr.Hex(16),
+		ExpiresAt: now.Add(ttl).Unix(),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+	}
+}
+
+func (c *TokenClaims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Valid checks the times without leeway, ValidateToken uses ValidAt with
+// the configured leeway instead.
+func (c *TokenClaims) Valid() error {
+	return c.ValidAt(time.Now(), 0)
+}
+
+// ValidAt checks "exp", "nbf" and "iat" at now, allowing leeway for clocks
+// that are out of sync.
+func (c *TokenClaims) ValidAt(now time.Time, leeway time.Duration) error {
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("token is expired")
+	}
+
+	if now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	if now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token used before issued")
+	}
+
+	return nil
+}
+
+// TokenOptions are the issuer and audience access tokens are created with
+// and that ValidateToken requires, when they are set.
+type TokenOptions struct {
+	Issuer   string
+	Audience Audience
+	Leeway   time.Duration
+}
+
+// LoadTokenOptions reads TOKEN_ISSUER, the comma separated TOKEN_AUDIENCE
+// and TOKEN_LEEWAY, 30 seconds when it is not set.
+func LoadTokenOptions() TokenOptions {
+	config, _ := config.LoadConfig(".")
+
+	options := TokenOptions{Issuer: config.TokenIssuer, Leeway: config.TokenLeeway}
+
+	for _, audience := range strings.Split(config.TokenAudience, ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			options.Audience = append(options.Audience, audience)
+		}
+	}
+
+	if options.Leeway <= 0 {
+		options.Leeway = defaultTokenLeeway
+	}
+
+	return options
+}
+
+// verify checks the claims against the options. A token is accepted when it
+// names at least one of the audiences of the options.
+func (o TokenOptions) verify(claims *TokenClaims, now time.Time) error {
+	if err := claims.ValidAt(now, o.Leeway); err != nil {
+		return err
+	}
+
+	if o.Issuer != "" && claims.Issuer != o.Issuer {
+		return errors.New("invalid token issuer")
+	}
+
+	if len(o.Audience) > 0 {
+		for _, audience := range o.Audience {
+			if claims.Audience.Contains(audience) {
+				return nil
+			}
+		}
+		return errors.New("invalid token audience")
+	}
+
+	return nil
+}
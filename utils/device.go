@@ -0,0 +1,49 @@
+package utils
+
+import "strings"
+
+// DescribeDevice turns a user agent into a short description such as
+// "Chrome on macOS" for the session list. It only knows the common browsers
+// and platforms and falls back to "Unknown".
+func DescribeDevice(userAgent string) string {
+	browser := firstMatch(userAgent, []string{
+		"Edg/", "Edge",
+		"OPR/", "Opera",
+		"Firefox/", "Firefox",
+		"Chrome/", "Chrome",
+		"Safari/", "Safari",
+		"curl/", "curl",
+	})
+	platform := firstMatch(userAgent, []string{
+		"iPhone", "iOS",
+		"iPad", "iPadOS",
+		"Android", "Android",
+		"Windows", "Windows",
+		"Mac OS X", "macOS",
+		"CrOS", "ChromeOS",
+		"Linux", "Linux",
+	})
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+
+	return "Unknown"
+}
+
+// firstMatch returns the name of the first token found in s. pairs holds
+// tokens followed by their names.
+func firstMatch(s string, pairs []string) string {
+	for i := 0; i < len(pairs); i += 2 {
+		if strings.Contains(s, pairs[i]) {
+			return pairs[i+1]
+		}
+	}
+
+	return ""
+}
@@ -17,6 +17,8 @@ type EmailData struct {
 	URL       string
 	FirstName string
 	Subject   string
+	Message   string
+	Code      string
 }
 
 func SendEmail(user *models.DBResponse, data *EmailData, temp *template.Template, templateName string) error {
@@ -1,10 +1,24 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+
+	"github.com/tonybobo/auth-template/config"
 )
 
+// tokenHashPrefix marks keyed hashes. It is not part of the base64 alphabet,
+// so no token can be made to match a hash through the legacy base64 lookup.
+const tokenHashPrefix = "hmac-sha256:"
+
+// ErrTokenHashSecretMissing is returned by the keyed hashes while
+// TOKEN_HASH_SECRET is not set. main refuses to start without it.
+var ErrTokenHashSecretMissing = errors.New("TOKEN_HASH_SECRET is not set")
+
 func Encode(s string) string {
 	data := base64.StdEncoding.EncodeToString([]byte(s))
 	return string(data)
@@ -18,3 +32,29 @@ func Decode(s string) (string, error) {
 
 	return string(data), nil
 }
+
+// HashToken returns the HMAC-SHA256 of a one-time token keyed with
+// TOKEN_HASH_SECRET. Only the hash is stored, so a copy of the database does
+// not hold usable tokens.
+func HashToken(token string) (string, error) {
+	sum, err := KeyedHash(token)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenHashPrefix + hex.EncodeToString(sum), nil
+}
+
+// KeyedHash returns the HMAC-SHA256 of s keyed with TOKEN_HASH_SECRET.
+func KeyedHash(s string) ([]byte, error) {
+	config, _ := config.LoadConfig(".")
+
+	if config.TokenHashSecret == "" {
+		return nil, ErrTokenHashSecretMissing
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.TokenHashSecret))
+	mac.Write([]byte(s))
+
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Encrypt seals s with AES-GCM using the base64 encoded 32 byte key. The
+// nonce is prepended to the ciphertext and the result is base64 encoded.
+func Encrypt(s string, key string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(s), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func Decrypt(s string, key string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("decoding error , %w", err)
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid ciphertext")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting %w", err)
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(key string) (cipher.AEAD, error) {
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key:%w", err)
+	}
+
+	block, err := aes.NewCipher(decodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing key %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,322 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+)
+
+// signingMethods is the allow-list of token algorithms. A key only ever
+// verifies tokens of the one algorithm it is configured with.
+var signingMethods = map[string]jwt.SigningMethod{
+	jwt.SigningMethodRS256.Alg(): jwt.SigningMethodRS256,
+	jwt.SigningMethodPS256.Alg(): jwt.SigningMethodPS256,
+	jwt.SigningMethodES256.Alg(): jwt.SigningMethodES256,
+	jwt.SigningMethodEdDSA.Alg(): jwt.SigningMethodEdDSA,
+}
+
+// SigningKey is a token key with its "kid" and algorithm. PrivateKey is nil
+// for a key that only verifies tokens, like a retired key whose tokens have
+// not expired yet.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+func (k *SigningKey) Method() jwt.SigningMethod {
+	return signingMethods[k.Algorithm]
+}
+
+// KeyRing holds every key tokens are verified with and the one new tokens
+// are signed with.
+type KeyRing struct {
+	keys    []*SigningKey
+	signing *SigningKey
+}
+
+func NewKeyRing(keys []*SigningKey, signingKeyId string) (*KeyRing, error) {
+	ring := &KeyRing{}
+
+	for _, key := range keys {
+		if _, ok := ring.Key(key.ID); ok {
+			return nil, fmt.Errorf("key id %q is listed twice", key.ID)
+		}
+		ring.keys = append(ring.keys, key)
+
+		if key.ID == signingKeyId {
+			ring.signing = key
+		}
+	}
+
+	if ring.signing == nil {
+		return nil, fmt.Errorf("signing key %q is not in the key ring", signingKeyId)
+	}
+	if ring.signing.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyId)
+	}
+
+	return ring, nil
+}
+
+func (r *KeyRing) SigningKey() *SigningKey {
+	return r.signing
+}
+
+func (r *KeyRing) Key(id string) (*SigningKey, bool) {
+	for _, key := range r.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *KeyRing) Keys() []*SigningKey {
+	return r.keys
+}
+
+// JWKS returns the public keys of the ring for /.well-known/jwks.json.
+func (r *KeyRing) JWKS() *models.JWKS {
+	jwks := &models.JWKS{Keys: []models.JWK{}}
+
+	for _, key := range r.keys {
+		jwk := publicJWK(key.PublicKey)
+		jwk.Use = "sig"
+		jwk.Alg = key.Algorithm
+		jwk.Kid = key.ID
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// publicJWK returns the key type specific members of the JWK, RFC 7518 for
+// RSA and EC keys and RFC 8037 for Ed25519 keys.
+func publicJWK(key crypto.PublicKey) models.JWK {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return models.JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return models.JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return models.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	}
+
+	return models.JWK{}
+}
+
+// ParseSigningKey reads a base64 encoded PEM key, either a private key or
+// only the public key. Without an algorithm RSA keys use RS256, P-256 keys
+// ES256 and Ed25519 keys EdDSA.
+func ParseSigningKey(id, algorithm, encoded string) (*SigningKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key %q:%w", id, err)
+	}
+
+	privateKey, publicKey, err := parsePEMKey(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing key %q %w", id, err)
+	}
+
+	if algorithm == "" {
+		algorithm = defaultAlgorithm(publicKey)
+	}
+
+	if err := checkAlgorithm(algorithm, publicKey); err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	return &SigningKey{ID: id, Algorithm: algorithm, PrivateKey: privateKey, PublicKey: publicKey}, nil
+}
+
+func parsePEMKey(decoded []byte) (crypto.PrivateKey, crypto.PublicKey, error) {
+	block, _ := pem.Decode(decoded)
+	if block == nil {
+		return nil, nil, errors.New("key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return key, signer.Public(), nil
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, &key.PublicKey, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, &key.PublicKey, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return nil, key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return nil, key, nil
+	}
+
+	return nil, nil, errors.New("unsupported key")
+}
+
+func defaultAlgorithm(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		return jwt.SigningMethodES256.Alg()
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg()
+	}
+
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func checkAlgorithm(algorithm string, key crypto.PublicKey) error {
+	if _, ok := signingMethods[algorithm]; !ok {
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm == jwt.SigningMethodRS256.Alg() || algorithm == jwt.SigningMethodPS256.Alg() {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if algorithm == jwt.SigningMethodES256.Alg() && key.Curve == elliptic.P256() {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if algorithm == jwt.SigningMethodEdDSA.Alg() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("algorithm %s does not match the key", algorithm)
+}
+
+// ParseKeyRing reads keys in the form "kid:key,kid:alg:key" where every key
+// is a base64 encoded PEM key. The first key signs when signingKeyId is
+// empty.
+func ParseKeyRing(s string, signingKeyId string) (*KeyRing, error) {
+	var keys []*SigningKey
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		id := strings.TrimSpace(parts[0])
+		if len(parts) < 2 || len(parts) > 3 || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q", id)
+		}
+
+		var algorithm string
+		if len(parts) == 3 {
+			algorithm = strings.TrimSpace(parts[1])
+		}
+
+		key, err := ParseSigningKey(id, algorithm, strings.TrimSpace(parts[len(parts)-1]))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in the key ring")
+	}
+
+	if signingKeyId == "" {
+		signingKeyId = keys[0].ID
+	}
+
+	return NewKeyRing(keys, signingKeyId)
+}
+
+var accessTokenKeyRing struct {
+	once sync.Once
+	ring *KeyRing
+	err  error
+}
+
+// LoadAccessTokenKeyRing reads the access token keys from ACCESS_TOKEN_KEYS
+// and signs with ACCESS_TOKEN_SIGNING_KEY_ID the first time it is called.
+// Without ACCESS_TOKEN_KEYS the ring only holds ACCESS_TOKEN_PRIVATE_KEY,
+// named by its RFC 7638 thumbprint. To rotate, add the new key, publish it
+// for a while, switch the signing key and drop the old key once the tokens it
+// signed have expired. Every step needs a restart.
+func LoadAccessTokenKeyRing() (*KeyRing, error) {
+	accessTokenKeyRing.once.Do(func() {
+		accessTokenKeyRing.ring, accessTokenKeyRing.err = loadAccessTokenKeyRing()
+	})
+
+	return accessTokenKeyRing.ring, accessTokenKeyRing.err
+}
+
+func loadAccessTokenKeyRing() (*KeyRing, error) {
+	config, _ := config.LoadConfig(".")
+
+	if config.AccessTokenKeys != "" {
+		return ParseKeyRing(config.AccessTokenKeys, config.AccessTokenSigningKeyId)
+	}
+
+	key, err := ParseSigningKey("", "", config.AccessTokenPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = KeyThumbprint(key.PublicKey)
+
+	return NewKeyRing([]*SigningKey{key}, key.ID)
+}
+
+// KeyThumbprint is the RFC 7638 JWK thumbprint of a public key, the hash of
+// its required JWK members in lexicographic order.
+func KeyThumbprint(key crypto.PublicKey) string {
+	jwk := publicJWK(key)
+
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	case "EC":
+		members = `{"crv":"` + jwk.Crv + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	case "OKP":
+		members = `{"crv":"` + jwk.Crv + `","kty":"OKP","x":"` + jwk.X + `"}`
+	}
+
+	sum := sha256.Sum256([]byte(members))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
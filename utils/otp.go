@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// GenerateEmailOTP returns a random numeric code of the given length.
+func GenerateEmailOTP(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("error generating code %w", err)
+	}
+
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -1,13 +1,129 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+
+	// RFC 9106 second recommended option, 64 MiB of memory.
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 4
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unknown password hash")
+)
+
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// NewArgon2idHasher makes hashes in the PHC string format
+// "$argon2id$v=19$m=65536,t=3,p=4$salt$key", so every hash keeps the
+// parameters it was made with.
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) models.PasswordHasher {
+	return &argon2idHasher{memory: memory, iterations: iterations, parallelism: parallelism}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error while hashing password %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.memory < h.memory || params.iterations < h.iterations || params.parallelism < h.parallelism || len(key) < argon2KeyLength
+}
+
+func decodeArgon2id(hash string) (*argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	params := &argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher is kept for the hashes made before argon2id became the
+// default, or when PASSWORD_HASH_ALGORITHM is set to bcrypt.
+func NewBcryptHasher(cost int) models.PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
 	if err != nil {
 		return "", fmt.Errorf("error while hashing password %w", err)
 	}
@@ -15,6 +131,132 @@ func HashPassword(password string) (string, error) {
 	return string(hashPassword), nil
 }
 
+func (h *bcryptHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *bcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+
+	return err
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost < h.cost
+}
+
+// CurrentPasswordHasher is the hasher new hashes are made with, configured by
+// PASSWORD_HASH_ALGORITHM and the ARGON2_* or BCRYPT_COST settings, and
+// peppered with the PASSWORD_PEPPER_VERSION pepper when one is set.
+func CurrentPasswordHasher() (models.PasswordHasher, error) {
+	version, peppers, err := LoadPasswordPeppers()
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := currentAlgorithmHasher()
+	if version == "" {
+		return hasher, nil
+	}
+
+	return NewPepperedHasher(hasher, version, peppers[version]), nil
+}
+
+func currentAlgorithmHasher() models.PasswordHasher {
+	config, _ := config.LoadConfig(".")
+
+	if config.PasswordHashAlgorithm == PasswordHashBcrypt {
+		cost := config.BcryptCost
+		if cost <= 0 {
+			cost = bcrypt.DefaultCost
+		}
+		return NewBcryptHasher(cost)
+	}
+
+	memory := config.Argon2Memory
+	if memory == 0 {
+		memory = defaultArgon2Memory
+	}
+	iterations := config.Argon2Iterations
+	if iterations == 0 {
+		iterations = defaultArgon2Iterations
+	}
+	parallelism := config.Argon2Parallelism
+	if parallelism == 0 {
+		parallelism = defaultArgon2Parallelism
+	}
+
+	return NewArgon2idHasher(memory, iterations, parallelism)
+}
+
+// passwordHasherFor returns the hasher that understands hash. The parameters
+// of the hash are read from the hash itself, the pepper from its version.
+func passwordHasherFor(hash string) (models.PasswordHasher, error) {
+	version, inner := splitPepperedHash(hash)
+
+	var hasher models.PasswordHasher
+	for _, candidate := range []models.PasswordHasher{NewArgon2idHasher(0, 0, 0), NewBcryptHasher(0)} {
+		if candidate.Supports(inner) {
+			hasher = candidate
+			break
+		}
+	}
+
+	if hasher == nil {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	if version == "" {
+		return hasher, nil
+	}
+
+	_, peppers, err := LoadPasswordPeppers()
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := peppers[version]
+	if !ok {
+		return nil, ErrUnknownPepper
+	}
+
+	return NewPepperedHasher(hasher, version, key), nil
+}
+
+func HashPassword(password string) (string, error) {
+	hasher, err := CurrentPasswordHasher()
+	if err != nil {
+		return "", err
+	}
+
+	return hasher.Hash(password)
+}
+
 func VerifyPassword(hashedPassword string, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	hasher, err := passwordHasherFor(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	return hasher.Verify(hashedPassword, password)
+}
+
+// PasswordNeedsRehash tells whether hashedPassword was made with another
+// algorithm, weaker parameters or another pepper than CurrentPasswordHasher.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	current, err := CurrentPasswordHasher()
+	if err != nil {
+		return false
+	}
+
+	if !current.Supports(hashedPassword) {
+		return true
+	}
+
+	return current.NeedsRehash(hashedPassword)
 }
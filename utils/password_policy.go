@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+)
+
+type breachedPasswordFile struct {
+	file *os.File
+	size int64
+}
+
+// NewBreachedPasswordFile opens a file with one "SHA1HASH:COUNT" line per
+// breached password, sorted by hash as written by the Pwned Passwords
+// downloader. The count is optional. The file is not loaded into memory,
+// every lookup binary searches it for the lines of the requested prefix.
+func NewBreachedPasswordFile(path string) (models.BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	breached := &breachedPasswordFile{file: file, size: info.Size()}
+
+	// Check the first entry so that a file in another format fails at startup
+	// rather than on the first password change.
+	if breached.size > 0 {
+		if _, _, err := breached.entryAt(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return breached, nil
+}
+
+func (b *breachedPasswordFile) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+
+	// Find the first offset whose next line has a hash at or after prefix.
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := b.lineStart(mid)
+		if err != nil {
+			return nil, err
+		}
+		if start >= b.size {
+			hi = mid
+			continue
+		}
+
+		hash, _, err := b.entryAt(start)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash[:len(prefix)] < prefix {
+			lo = start + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	start, err := b.lineStart(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := map[string]int{}
+	reader := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			hash, count, err := parseBreachedEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(hash, prefix) {
+				break
+			}
+			suffixes[hash[len(prefix):]] += count
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	return suffixes, nil
+}
+
+// lineStart returns the offset of the first line that starts at or after
+// offset, or the size of the file when there is none.
+func (b *breachedPasswordFile) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(b.file, offset-1, b.size-offset+1))
+
+	skipped, err := reader.ReadString('\n')
+	if err == io.EOF {
+		return b.size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return offset - 1 + int64(len(skipped)), nil
+}
+
+// entryAt parses the line that starts at offset.
+func (b *breachedPasswordFile) entryAt(offset int64) (string, int, error) {
+	reader := bufio.NewReader(io.NewSectionReader(b.file, offset, b.size-offset))
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+
+	return parseBreachedEntry(strings.TrimSpace(line))
+}
+
+func parseBreachedEntry(entry string) (string, int, error) {
+	hash, value, hasCount := strings.Cut(entry, ":")
+	hash = strings.ToUpper(hash)
+	if len(hash) != 40 || strings.Trim(hash, "0123456789ABCDEF") != "" {
+		return "", 0, fmt.Errorf("invalid breached password entry %q", entry)
+	}
+
+	count := 1
+	if hasCount {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil || count < 1 {
+			return "", 0, fmt.Errorf("invalid breached password count in %q", entry)
+		}
+	}
+
+	return hash, count, nil
+}
+
+var passwordPolicy struct {
+	once   sync.Once
+	policy *models.PasswordPolicy
+}
+
+// LoadPasswordPolicy reads the PASSWORD_* settings the first time it is
+// called, together with the breached password file when one is set.
+func LoadPasswordPolicy() *models.PasswordPolicy {
+	passwordPolicy.once.Do(func() {
+		config, _ := config.LoadConfig(".")
+
+		policy := &models.PasswordPolicy{
+			MinLength:     config.PasswordMinLength,
+			MaxLength:     config.PasswordMaxLength,
+			RequireUpper:  config.PasswordRequireUpper,
+			RequireLower:  config.PasswordRequireLower,
+			RequireDigit:  config.PasswordRequireDigit,
+			RequireSymbol: config.PasswordRequireSymbol,
+		}
+
+		for _, denied := range strings.Split(config.PasswordDenylist, ",") {
+			if denied = strings.TrimSpace(denied); denied != "" {
+				policy.Denylist = append(policy.Denylist, denied)
+			}
+		}
+
+		if config.PasswordBreachedFile != "" {
+			breached, err := NewBreachedPasswordFile(config.PasswordBreachedFile)
+			if err != nil {
+				log.Fatal("Could not load PASSWORD_BREACHED_FILE ", err)
+			}
+			policy.Breached = breached
+		}
+
+		passwordPolicy.policy = policy
+	})
+
+	return passwordPolicy.policy
+}
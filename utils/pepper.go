@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+)
+
+// pepperedHashPrefix is followed by the pepper version and the hash of the
+// peppered password, as in "$pepper$2$argon2id$v=19$...".
+const pepperedHashPrefix = "$pepper$"
+
+var ErrUnknownPepper = errors.New("unknown password pepper version")
+
+type pepperedHasher struct {
+	hasher  models.PasswordHasher
+	version string
+	key     []byte
+}
+
+// NewPepperedHasher hashes the HMAC-SHA256 of the password keyed with the
+// pepper instead of the password, so the hashes in a copy of the database
+// cannot be cracked without the pepper. The pepper version is kept in the
+// hash so older peppers can still be verified after a rotation.
+func NewPepperedHasher(hasher models.PasswordHasher, version string, key []byte) models.PasswordHasher {
+	return &pepperedHasher{hasher: hasher, version: version, key: key}
+}
+
+func (h *pepperedHasher) Hash(password string) (string, error) {
+	hash, err := h.hasher.Hash(h.pepper(password))
+	if err != nil {
+		return "", err
+	}
+
+	return pepperedHashPrefix + h.version + hash, nil
+}
+
+func (h *pepperedHasher) Supports(hash string) bool {
+	version, inner := splitPepperedHash(hash)
+
+	return version == h.version && h.hasher.Supports(inner)
+}
+
+func (h *pepperedHasher) Verify(hash, password string) error {
+	_, inner := splitPepperedHash(hash)
+
+	return h.hasher.Verify(inner, h.pepper(password))
+}
+
+func (h *pepperedHasher) NeedsRehash(hash string) bool {
+	_, inner := splitPepperedHash(hash)
+
+	return h.hasher.NeedsRehash(inner)
+}
+
+func (h *pepperedHasher) pepper(password string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(password))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitPepperedHash returns the pepper version and the hash it wraps. The
+// version is empty for a hash made without a pepper.
+func splitPepperedHash(hash string) (string, string) {
+	if !strings.HasPrefix(hash, pepperedHashPrefix) {
+		return "", hash
+	}
+
+	version, inner, found := strings.Cut(strings.TrimPrefix(hash, pepperedHashPrefix), "$")
+	if !found || version == "" {
+		return "", hash
+	}
+
+	return version, "$" + inner
+}
+
+// ParsePasswordPeppers reads peppers in the form "1:secret,2:secret". Old
+// versions have to stay listed until every hash made with them is migrated.
+func ParsePasswordPeppers(s string) (map[string][]byte, error) {
+	peppers := map[string][]byte{}
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		version, secret, found := strings.Cut(entry, ":")
+		version = strings.TrimSpace(version)
+		if !found || version == "" || strings.Contains(version, "$") || secret == "" {
+			return nil, fmt.Errorf("invalid pepper entry for version %q", version)
+		}
+		if _, ok := peppers[version]; ok {
+			return nil, fmt.Errorf("pepper version %q is listed twice", version)
+		}
+
+		peppers[version] = []byte(secret)
+	}
+
+	return peppers, nil
+}
+
+// LoadPasswordPeppers reads PASSWORD_PEPPERS and the version new hashes are
+// made with from PASSWORD_PEPPER_VERSION. Passwords are not peppered while
+// the version is empty.
+func LoadPasswordPeppers() (string, map[string][]byte, error) {
+	config, _ := config.LoadConfig(".")
+
+	peppers, err := ParsePasswordPeppers(config.PasswordPeppers)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if config.PasswordPepperVersion != "" && peppers[config.PasswordPepperVersion] == nil {
+		return "", nil, fmt.Errorf("PASSWORD_PEPPER_VERSION %q is not in PASSWORD_PEPPERS", config.PasswordPepperVersion)
+	}
+
+	return config.PasswordPepperVersion, peppers, nil
+}
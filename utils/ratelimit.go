@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+)
+
+const rateLimitSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	period    time.Duration
+}
+
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiter keeps its buckets in process, so every replica counts
+// requests on its own.
+func NewMemoryRateLimiter() models.RateLimiter {
+	return &memoryRateLimiter{buckets: map[string]*tokenBucket{}, lastSweep: time.Now()}
+}
+
+func (l *memoryRateLimiter) Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(policy.Limit), updatedAt: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = policy.Refill(bucket.tokens, now.Sub(bucket.updatedAt))
+	bucket.updatedAt = now
+	bucket.period = policy.Period
+
+	if bucket.tokens < 1 {
+		return false, policy.RetryAfter(bucket.tokens), nil
+	}
+
+	bucket.tokens--
+	return true, 0, nil
+}
+
+// sweep drops the buckets that have refilled completely, they behave the same
+// as a missing bucket.
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updatedAt) >= bucket.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// LoadRateLimitPolicies reads the per route policies from RATE_LIMITS on top
+// of models.DefaultRateLimitPolicies.
+func LoadRateLimitPolicies() models.RateLimitPolicies {
+	config, _ := config.LoadConfig(".")
+
+	policies, err := models.ParseRateLimitPolicies(config.RateLimits)
+	if err != nil {
+		log.Fatal("Could not load RATE_LIMITS ", err)
+	}
+
+	return policies
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"log"
+
+	"github.com/tonybobo/auth-template/config"
+	"github.com/tonybobo/auth-template/models"
+)
+
+// LoadRolePermissions reads the role to permission mapping from
+// ROLE_PERMISSIONS and falls back to models.DefaultRolePermissions.
+func LoadRolePermissions() models.RolePermissions {
+	config, _ := config.LoadConfig(".")
+
+	if config.RolePermissions == "" {
+		return models.DefaultRolePermissions
+	}
+
+	rolePermissions, err := models.ParseRolePermissions(config.RolePermissions)
+	if err != nil {
+		log.Fatal("Could not load ROLE_PERMISSIONS ", err)
+	}
+
+	return rolePermissions
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"crypto"
 	"encoding/base64"
 	"fmt"
 	"time"
@@ -8,7 +9,15 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (string, error) {
+// CreateToken signs an access token with the signing key of the ring and
+// names the key in the "kid" header.
+func CreateToken(claims *TokenClaims, ring *KeyRing) (string, error) {
+	return SignToken(claims, ring.SigningKey())
+}
+
+// CreateTokenWithClaims signs a refresh token with a single RSA key and
+// embeds the given extra claims (for example the "jti" of the token).
+func CreateTokenWithClaims(ttl time.Duration, payload interface{}, extra map[string]interface{}, privateKey string) (string, error) {
 	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
 	if err != nil {
 		return "", fmt.Errorf("could not decode key:%w", err)
@@ -19,24 +28,95 @@ func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (str
 		return "", fmt.Errorf("error while parsing key %w", err)
 	}
 
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, newClaims(ttl, payload, extra)).SignedString(key)
+
+	if err != nil {
+		return "", fmt.Errorf("error while signing token %w", err)
+	}
+
+	return token, nil
+}
+
+// SignToken signs the claims as they are with the algorithm of the key.
+func SignToken(claims jwt.Claims, key *SigningKey) (string, error) {
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("error while signing token %w", err)
+	}
+
+	return signed, nil
+}
+
+func newClaims(ttl time.Duration, payload interface{}, extra map[string]interface{}) jwt.MapClaims {
 	now := time.Now().UTC()
 
 	claims := make(jwt.MapClaims)
+	for k, v := range extra {
+		claims[k] = v
+	}
 	claims["sub"] = payload
 	claims["exp"] = now.Add(ttl).Unix()
 	claims["iat"] = now.Unix()
 	claims["nbf"] = now.Unix()
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	return claims
+}
 
+// ValidateToken verifies an access token signed by a key of the ring, picked
+// by the "kid" header, and checks it against LoadTokenOptions.
+func ValidateToken(token string, ring *KeyRing) (*TokenClaims, error) {
+	return ValidateTokenWithOptions(token, ring, LoadTokenOptions())
+}
+
+// ValidateTokenWithOptions is ValidateToken with the issuer, audience and
+// leeway of options. The token has to use the algorithm of its key. Tokens
+// from before key ids were added have no "kid" and are tried against every
+// key.
+func ValidateTokenWithOptions(token string, ring *KeyRing, options TokenOptions) (*TokenClaims, error) {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(token, &TokenClaims{})
 	if err != nil {
-		return "", fmt.Errorf("error while signing token %w", err)
+		return nil, fmt.Errorf("error parsing token %w", err)
 	}
 
-	return token, nil
+	kid, _ := unverified.Header["kid"].(string)
+
+	var claims *TokenClaims
+	if kid != "" {
+		key, ok := ring.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		claims = &TokenClaims{}
+		if err := verifySignature(token, key.Method(), key.PublicKey, claims); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, key := range ring.Keys() {
+			candidate := &TokenClaims{}
+			if verifySignature(token, key.Method(), key.PublicKey, candidate) == nil {
+				claims = candidate
+				break
+			}
+		}
+
+		if claims == nil {
+			return nil, fmt.Errorf("invalid token")
+		}
+	}
+
+	if err := options.verify(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
-func ValidateToken(token string, publicKey string) (interface{}, error) {
+// ParseToken verifies the token and returns all of its claims.
+func ParseToken(token string, publicKey string) (jwt.MapClaims, error) {
 	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
 	if err != nil {
 		return nil, fmt.Errorf("error decoding public key %w", err)
@@ -48,12 +128,11 @@ func ValidateToken(token string, publicKey string) (interface{}, error) {
 		return nil, fmt.Errorf("error parsing public key %w", err)
 	}
 
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected method %s", t.Header["alg"])
-		}
-		return key, nil
-	})
+	return parseSignedToken(token, jwt.SigningMethodRS256, key)
+}
+
+func parseSignedToken(token string, method jwt.SigningMethod, key crypto.PublicKey) (jwt.MapClaims, error) {
+	parsedToken, err := jwt.Parse(token, keyFunc(method, key))
 
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token %w", err)
@@ -65,5 +144,26 @@ func ValidateToken(token string, publicKey string) (interface{}, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
-	return claims["sub"], nil
+	return claims, nil
+}
+
+// verifySignature only checks the signature into claims, the claims are
+// checked by the caller.
+func verifySignature(token string, method jwt.SigningMethod, key crypto.PublicKey, claims jwt.Claims) error {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	if _, err := parser.ParseWithClaims(token, claims, keyFunc(method, key)); err != nil {
+		return fmt.Errorf("error parsing token %w", err)
+	}
+
+	return nil
+}
+
+func keyFunc(method jwt.SigningMethod, key crypto.PublicKey) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected method %s", t.Header["alg"])
+		}
+		return key, nil
+	}
 }
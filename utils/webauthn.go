@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Authenticator data flags, see https://www.w3.org/TR/webauthn-2/#flags
+const (
+	WebAuthnFlagUserPresent   byte = 0x01
+	WebAuthnFlagUserVerified  byte = 0x04
+	WebAuthnFlagAttestedData  byte = 0x40
+	WebAuthnFlagExtensionData byte = 0x80
+)
+
+const (
+	webAuthnRPIDHashLength       = 32
+	webAuthnAAGUIDLength         = 16
+	webAuthnMinAuthenticatorData = webAuthnRPIDHashLength + 1 + 4
+)
+
+// COSE algorithm identifiers of the public key types we accept.
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+const (
+	coseKtyOKP int64 = 1
+	coseKtyEC2 int64 = 2
+	coseKtyRSA int64 = 3
+
+	coseCrvP256    int64 = 1
+	coseCrvEd25519 int64 = 6
+)
+
+var webAuthnEncoding = base64.RawURLEncoding
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	// PublicKey is the COSE encoded credential public key, only present when
+	// the attested credential data flag is set.
+	PublicKey []byte
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+func GenerateWebAuthnChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", fmt.Errorf("error generating challenge %w", err)
+	}
+
+	return webAuthnEncoding.EncodeToString(challenge), nil
+}
+
+func EncodeWebAuthn(b []byte) string {
+	return webAuthnEncoding.EncodeToString(b)
+}
+
+// DecodeWebAuthn decodes the base64url values browsers send, with or without padding.
+func DecodeWebAuthn(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.URLEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding error , %w", err)
+	}
+
+	return b, nil
+}
+
+// VerifyClientData checks the collected client data of a ceremony and
+// returns the challenge it was signed for.
+func VerifyClientData(raw []byte, ceremonyType, origin string) (string, error) {
+	var clientData ClientData
+
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return "", fmt.Errorf("invalid client data %w", err)
+	}
+
+	if clientData.Type != ceremonyType {
+		return "", errors.New("invalid client data type")
+	}
+
+	if clientData.Origin != origin || clientData.CrossOrigin {
+		return "", errors.New("invalid client data origin")
+	}
+
+	if clientData.Challenge == "" {
+		return "", errors.New("missing client data challenge")
+	}
+
+	return clientData.Challenge, nil
+}
+
+// ParseAttestationObject returns the authenticator data of a registration.
+// Only "none" attestation is requested, so the attestation statement is not
+// verified.
+func ParseAttestationObject(raw []byte) (*AuthenticatorData, error) {
+	var attestation attestationObject
+
+	if err := cbor.Unmarshal(raw, &attestation); err != nil {
+		return nil, fmt.Errorf("invalid attestation object %w", err)
+	}
+
+	authData, err := ParseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if authData.Flags&WebAuthnFlagAttestedData == 0 || len(authData.CredentialID) == 0 {
+		return nil, errors.New("attestation has no credential data")
+	}
+
+	return authData, nil
+}
+
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < webAuthnMinAuthenticatorData {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  raw[:webAuthnRPIDHashLength],
+		Flags:     raw[webAuthnRPIDHashLength],
+		SignCount: binary.BigEndian.Uint32(raw[webAuthnRPIDHashLength+1 : webAuthnMinAuthenticatorData]),
+	}
+
+	if authData.Flags&WebAuthnFlagAttestedData == 0 {
+		return authData, nil
+	}
+
+	rest := raw[webAuthnMinAuthenticatorData:]
+	if len(rest) < webAuthnAAGUIDLength+2 {
+		return nil, errors.New("attested credential data too short")
+	}
+
+	authData.AAGUID = rest[:webAuthnAAGUIDLength]
+	idLength := int(binary.BigEndian.Uint16(rest[webAuthnAAGUIDLength : webAuthnAAGUIDLength+2]))
+	rest = rest[webAuthnAAGUIDLength+2:]
+
+	if len(rest) < idLength {
+		return nil, errors.New("attested credential data too short")
+	}
+
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	var publicKey cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &publicKey); err != nil {
+		return nil, fmt.Errorf("invalid credential public key %w", err)
+	}
+	authData.PublicKey = publicKey
+
+	return authData, nil
+}
+
+// VerifyRPIDHash checks that the authenticator data was created for rpID.
+func (a *AuthenticatorData) VerifyRPIDHash(rpID string) bool {
+	expected := sha256.Sum256([]byte(rpID))
+
+	return subtle.ConstantTimeCompare(a.RPIDHash, expected[:]) == 1
+}
+
+// ParseCOSEKey decodes a COSE encoded public key and returns its algorithm.
+func ParseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	var key map[int64]cbor.RawMessage
+
+	if err := cbor.Unmarshal(raw, &key); err != nil {
+		return nil, 0, fmt.Errorf("invalid credential public key %w", err)
+	}
+
+	var kty, alg int64
+	if err := cbor.Unmarshal(key[1], &kty); err != nil {
+		return nil, 0, errors.New("credential public key has no key type")
+	}
+	if err := cbor.Unmarshal(key[3], &alg); err != nil {
+		return nil, 0, errors.New("credential public key has no algorithm")
+	}
+
+	switch {
+	case kty == coseKtyEC2 && alg == COSEAlgES256:
+		var crv int64
+		var x, y []byte
+		if cbor.Unmarshal(key[-1], &crv) != nil || cbor.Unmarshal(key[-2], &x) != nil || cbor.Unmarshal(key[-3], &y) != nil {
+			return nil, 0, errors.New("invalid EC2 credential public key")
+		}
+		if crv != coseCrvP256 {
+			return nil, 0, errors.New("unsupported credential curve")
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, errors.New("invalid EC2 credential public key")
+		}
+		return publicKey, alg, nil
+
+	case kty == coseKtyOKP && alg == COSEAlgEdDSA:
+		var crv int64
+		var x []byte
+		if cbor.Unmarshal(key[-1], &crv) != nil || cbor.Unmarshal(key[-2], &x) != nil {
+			return nil, 0, errors.New("invalid OKP credential public key")
+		}
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("unsupported credential curve")
+		}
+		return ed25519.PublicKey(x), alg, nil
+
+	case kty == coseKtyRSA && alg == COSEAlgRS256:
+		var n, e []byte
+		if cbor.Unmarshal(key[-1], &n) != nil || cbor.Unmarshal(key[-2], &e) != nil {
+			return nil, 0, errors.New("invalid RSA credential public key")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, 0, errors.New("invalid RSA credential public key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported credential algorithm %d", alg)
+}
+
+// VerifyAssertionSignature checks the signature an authenticator produced
+// over the authenticator data and the hash of the client data.
+func VerifyAssertionSignature(coseKey, authData, clientDataJSON, signature []byte) error {
+	publicKey, alg, err := ParseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	switch alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(signed)
+		if ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+			return nil
+		}
+	case COSEAlgEdDSA:
+		if ed25519.Verify(publicKey.(ed25519.PublicKey), signed, signature) {
+			return nil
+		}
+	case COSEAlgRS256:
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("invalid assertion signature")
+}